@@ -0,0 +1,209 @@
+package audio
+
+import (
+	"bufio"
+	"crypto/md5"
+	"doubles/phash"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	envelopeSegments = 65
+	silenceLevel     = 64
+	flatEnvelope     = 0.05
+)
+
+var errUnsupported = errors.New("Unsupported audio format")
+
+func FrameHash(file *os.File, mimeType string) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := md5.New()
+	switch mimeType {
+	case "audio/mpeg":
+		start, err := id3Size(file)
+		if err != nil {
+			return nil, err
+		}
+		end, err := trailerStart(file, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		err = copySection(hash, file, start, end)
+	case "audio/flac":
+		start, err := flacAudioStart(file)
+		if err != nil {
+			return nil, err
+		}
+		end, err := trailerStart(file, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		err = copySection(hash, file, start, end)
+	case "application/ogg", "audio/ogg":
+		err = copyOggAudio(hash, file)
+	default:
+		err = errUnsupported
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+func copySection(w io.Writer, file *os.File, start, end int64) error {
+	if end < start {
+		return errUnsupported
+	}
+	_, err := io.Copy(w, io.NewSectionReader(file, start, end-start))
+	return err
+}
+
+func id3Size(file *os.File) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, nil
+}
+
+func trailerStart(file *os.File, end int64) (int64, error) {
+	if end >= 128 {
+		tag := make([]byte, 3)
+		if _, err := file.ReadAt(tag, end-128); err != nil {
+			return 0, err
+		}
+		if string(tag) == "TAG" {
+			end -= 128
+		}
+	}
+
+	if end >= 32 {
+		footer := make([]byte, 32)
+		if _, err := file.ReadAt(footer, end-32); err != nil {
+			return 0, err
+		}
+		if string(footer[:8]) == "APETAGEX" {
+			size := int64(binary.LittleEndian.Uint32(footer[12:16]))
+			if binary.LittleEndian.Uint32(footer[20:24])&(1<<31) != 0 {
+				size += 32
+			}
+			if size <= end {
+				end -= size
+			}
+		}
+	}
+	return end, nil
+}
+
+func flacAudioStart(file *os.File) (int64, error) {
+	header := make([]byte, 4)
+	offset, err := id3Size(file)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return 0, err
+	}
+	if string(header) != "fLaC" {
+		return 0, errUnsupported
+	}
+	offset += 4
+
+	for {
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return 0, err
+		}
+		offset += 4 + (int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3]))
+		if header[0]&0x80 != 0 {
+			return offset, nil
+		}
+	}
+}
+
+func copyOggAudio(w io.Writer, file *os.File) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	header := make([]byte, 27)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if string(header[:4]) != "OggS" {
+			return errUnsupported
+		}
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(reader, segments); err != nil {
+			return err
+		}
+		size := int64(0)
+		for _, s := range segments {
+			size += int64(s)
+		}
+
+		if binary.LittleEndian.Uint64(header[6:14]) == 0 {
+			if _, err := reader.Discard(int(size)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.CopyN(w, reader, size); err != nil {
+			return err
+		}
+	}
+}
+
+// Fingerprint describes the loudness envelope of a track: each bit tells
+// whether the next segment is louder than the previous one, which survives
+// re-encoding at a different bitrate. Tracks that are too short, silent or
+// equally loud throughout have no usable envelope and are reported as not ok.
+func Fingerprint(samples []int16) (phash.Hash, bool) {
+	var rms [envelopeSegments]float64
+	if len(samples) < envelopeSegments {
+		return 0, false
+	}
+	low, high := math.MaxFloat64, 0.0
+	for k := range rms {
+		start := k * len(samples) / envelopeSegments
+		end := (k + 1) * len(samples) / envelopeSegments
+		sum := 0.0
+		for _, s := range samples[start:end] {
+			sum += float64(s) * float64(s)
+		}
+		rms[k] = math.Sqrt(sum / float64(end-start))
+		low, high = math.Min(low, rms[k]), math.Max(high, rms[k])
+	}
+	if high < silenceLevel || high-low < flatEnvelope*high {
+		return 0, false
+	}
+
+	var hash phash.Hash
+	for k := 0; k < envelopeSegments-1; k++ {
+		if rms[k+1] > rms[k] {
+			hash |= 1 << uint(k)
+		}
+	}
+	return hash, true
+}
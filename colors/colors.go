@@ -0,0 +1,43 @@
+package colors
+
+import (
+	"regexp"
+
+	"github.com/logrusorgru/aurora"
+)
+
+var au = aurora.NewAurora(true)
+
+var escapes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func Enable(enabled bool) {
+	au = aurora.NewAurora(enabled)
+}
+
+func Strip(s string) string {
+	return escapes.ReplaceAllString(s, "")
+}
+
+func Red(arg interface{}) aurora.Value {
+	return au.Red(arg)
+}
+
+func Green(arg interface{}) aurora.Value {
+	return au.Green(arg)
+}
+
+func Brown(arg interface{}) aurora.Value {
+	return au.Brown(arg)
+}
+
+func Cyan(arg interface{}) aurora.Value {
+	return au.Cyan(arg)
+}
+
+func Gray(arg interface{}) aurora.Value {
+	return au.Gray(arg)
+}
+
+func Bold(arg interface{}) aurora.Value {
+	return au.Bold(arg)
+}
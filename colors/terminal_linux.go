@@ -0,0 +1,16 @@
+//go:build linux
+// +build linux
+
+package colors
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func IsTerminal(file *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
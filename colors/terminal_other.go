@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package colors
+
+import "os"
+
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -10,12 +10,21 @@ import (
 type Loader func(c *Config) error
 
 type Config struct {
-	ImageTypes []string `json:"image_types" xml:"image-type"`
-	DumpFile   string   `json:"dump_file" xml:"dump-file"`
+	ImageTypes     []string `json:"image_types" xml:"image-type"`
+	VideoTypes     []string `json:"video_types" xml:"video-type"`
+	AudioTypes     []string `json:"audio_types" xml:"audio-type"`
+	DumpFile       string   `json:"dump_file" xml:"dump-file"`
+	DatabaseFile   string   `json:"database_file" xml:"database-file"`
+	CheckpointFile string   `json:"checkpoint_file" xml:"checkpoint-file"`
 }
 
-func (c *Config) Load(loader Loader) error {
-	return loader(c)
+func (c *Config) Load(loaders ...Loader) error {
+	for _, loader := range loaders {
+		if err := loader(c); err != nil {
+			return err
+		}
+	}
+	return c.validate()
 }
 
 func (c *Config) validate() error {
@@ -48,9 +57,11 @@ func NewXMLLoader(filename string) Loader {
 		if err != nil {
 			return err
 		}
-		if err = xml.Unmarshal(data, c); err != nil {
+		layer := NewConfig()
+		if err = xml.Unmarshal(data, layer); err != nil {
 			return err
 		}
+		c.merge(layer)
 		return c.validate()
 	}
 }
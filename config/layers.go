@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+const (
+	EnvPrefix   = "DOUBLES_"
+	ProjectFile = "./config/config.json"
+)
+
+func NewDefaultLoader() Loader {
+	return func(c *Config) error {
+		c.ImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/tiff", "image/heic"}
+		c.VideoTypes = []string{"video/mp4", "video/webm", "video/avi", "video/quicktime"}
+		c.AudioTypes = []string{"audio/mpeg", "audio/flac", "application/ogg"}
+		c.DumpFile = "dump.json"
+		c.DatabaseFile = "doubles.db"
+		c.CheckpointFile = "doubles.checkpoint"
+		return nil
+	}
+}
+
+func NewFileLoader(filename string) Loader {
+	if strings.EqualFold(filepath.Ext(filename), ".xml") {
+		return NewXMLLoader(filename)
+	}
+	return NewJsonLoader(filename)
+}
+
+func Optional(loader Loader) Loader {
+	return func(c *Config) error {
+		if err := loader(c); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+}
+
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i] = strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+	}
+	return keys
+}
+
+// merge copies the fields set in layer, so lists replace the ones of earlier
+// layers instead of growing them.
+func (c *Config) merge(layer *Config) {
+	v, l := reflect.ValueOf(c).Elem(), reflect.ValueOf(layer).Elem()
+	for i := 0; i < l.NumField(); i++ {
+		if field := l.Field(i); field.Len() > 0 {
+			v.Field(i).Set(field)
+		}
+	}
+}
+
+func NewValuesLoader(values map[string]string) Loader {
+	return func(c *Config) error {
+		v := reflect.ValueOf(c).Elem()
+		known := make(map[string]bool)
+		for i, key := range Keys() {
+			known[key] = true
+			value, ok := values[key]
+			if !ok {
+				continue
+			}
+			switch field := v.Field(i); field.Kind() {
+			case reflect.String:
+				field.SetString(value)
+			case reflect.Slice:
+				var list []string
+				for _, item := range strings.Split(value, ",") {
+					if item = strings.TrimSpace(item); len(item) > 0 {
+						list = append(list, item)
+					}
+				}
+				field.Set(reflect.ValueOf(list))
+			}
+		}
+		for key := range values {
+			if !known[key] {
+				return fmt.Errorf("Unknown config key: %s", key)
+			}
+		}
+		return nil
+	}
+}
+
+func NewEnvLoader(prefix string) Loader {
+	values := make(map[string]string)
+	for _, key := range Keys() {
+		if value, ok := os.LookupEnv(prefix + strings.ToUpper(key)); ok {
+			values[key] = value
+		}
+	}
+	return NewValuesLoader(values)
+}
+
+func UserFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "doubles", "config.json")
+}
+
+// Later layers override earlier ones: built-in defaults, the user config,
+// the project config, an explicit config file, DOUBLES_* variables and flags.
+func SearchPath(filename string, settings map[string]string) []Loader {
+	loaders := []Loader{NewDefaultLoader()}
+	if user := UserFile(); len(user) > 0 {
+		loaders = append(loaders, Optional(NewJsonLoader(user)))
+	}
+	loaders = append(loaders, Optional(NewJsonLoader(ProjectFile)))
+	if len(filename) > 0 {
+		loaders = append(loaders, NewFileLoader(filename))
+	}
+	return append(loaders, NewEnvLoader(EnvPrefix), NewValuesLoader(settings))
+}
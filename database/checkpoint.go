@@ -0,0 +1,37 @@
+package database
+
+import (
+	. "doubles/types"
+	"encoding/json"
+	"io/ioutil"
+)
+
+type Checkpoint struct {
+	Database
+	Options *Options             `json:"options"`
+	Scanned bool                 `json:"scanned"`
+	Pending []*Image             `json:"pending"`
+	Walked  []string             `json:"walked,omitempty"`
+	Others  map[string]OtherFile `json:"others,omitempty"`
+}
+
+func NewCheckpoint(options *Options) *Checkpoint {
+	return &Checkpoint{Database: *New(), Options: options}
+}
+
+func (c *Checkpoint) Save(filename string) error {
+	return save(filename, c)
+}
+
+func LoadCheckpoint(filename string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCheckpoint(nil)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, c.init()
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	. "doubles/types"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const Version = 1
+
+var errVersion = errors.New("Unsupported database version")
+
+type Archive struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type Database struct {
+	Version  int                   `json:"version"`
+	Updated  time.Time             `json:"updated"`
+	Files    map[string]*FileState `json:"files"`
+	Archives map[string]Archive    `json:"archives"`
+	Groups   []string              `json:"groups"`
+	entries  map[string][]*FileState
+}
+
+func isUnchanged(size int64, modTime time.Time, info os.FileInfo) bool {
+	return size == info.Size() && modTime.Equal(info.ModTime())
+}
+
+func IsUnder(filename, root string) bool {
+	prefix := filepath.Clean(root)
+	if !strings.HasSuffix(prefix, string(os.PathSeparator)) {
+		prefix += string(os.PathSeparator)
+	}
+	return strings.HasPrefix(filename, prefix)
+}
+
+func (d *Database) Lookup(filename string, info os.FileInfo) (*FileState, bool) {
+	state, ok := d.Files[filename]
+	if !ok {
+		return nil, false
+	}
+	return state, isUnchanged(state.Image.Size, state.Image.ModTime, info)
+}
+
+func (d *Database) Entries(archive string, info os.FileInfo) ([]*FileState, bool) {
+	a, ok := d.Archives[archive]
+	if !ok || !isUnchanged(a.Size, a.ModTime, info) {
+		return nil, false
+	}
+	return d.entries[archive], true
+}
+
+func (d *Database) Exists(state *FileState) bool {
+	if archive := state.Image.Archive; len(archive) > 0 {
+		info, err := os.Stat(archive)
+		if err != nil {
+			return false
+		}
+		_, unchanged := d.Entries(archive, info)
+		return unchanged
+	}
+	_, err := os.Stat(state.Image.Path)
+	return err == nil
+}
+
+func (d *Database) Update(states map[string]*FileState, deleted []string, groups []string) {
+	for _, filename := range deleted {
+		delete(d.Files, filename)
+	}
+	for filename := range d.Archives {
+		if _, err := os.Stat(filename); err != nil {
+			delete(d.Archives, filename)
+		}
+	}
+
+	for filename, state := range states {
+		d.Files[filename] = state
+		if archive := state.Image.Archive; len(archive) > 0 {
+			if info, err := os.Stat(archive); err == nil {
+				d.Archives[archive] = Archive{Size: info.Size(), ModTime: info.ModTime()}
+			}
+		}
+	}
+	d.Groups = groups
+	d.Updated = time.Now()
+	d.index()
+}
+
+func (d *Database) index() {
+	d.entries = make(map[string][]*FileState)
+	for _, state := range d.Files {
+		if archive := state.Image.Archive; len(archive) > 0 {
+			d.entries[archive] = append(d.entries[archive], state)
+		}
+	}
+}
+
+func (d *Database) Save(filename string) error {
+	return save(filename, d)
+}
+
+func save(filename string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	temp := filename + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, filename)
+}
+
+func New() *Database {
+	return &Database{
+		Version:  Version,
+		Files:    make(map[string]*FileState),
+		Archives: make(map[string]Archive),
+		entries:  make(map[string][]*FileState),
+	}
+}
+
+func Load(filename string) (*Database, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := New()
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	return d, d.init()
+}
+
+func (d *Database) init() error {
+	if d.Version != Version {
+		return errVersion
+	}
+	if d.Files == nil {
+		d.Files = make(map[string]*FileState)
+	}
+	if d.Archives == nil {
+		d.Archives = make(map[string]Archive)
+	}
+	d.index()
+	return nil
+}
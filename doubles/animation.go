@@ -0,0 +1,265 @@
+package doubles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+const maxFrames = 16
+
+const (
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendSource       = 0
+	maxPNGChunk           = 1 << 28
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	errNoFrames  = errors.New("No frames found")
+	errBadPNG    = errors.New("Invalid animated PNG")
+)
+
+func isFrameSampled(frame, count int) bool {
+	if count <= maxFrames {
+		return true
+	}
+	for k := 0; k < maxFrames; k++ {
+		if k*count/maxFrames == frame {
+			return true
+		}
+	}
+	return false
+}
+
+func snapshot(canvas *image.RGBA) *image.RGBA {
+	res := image.NewRGBA(canvas.Bounds())
+	copy(res.Pix, canvas.Pix)
+	return res
+}
+
+func decodeGIFFrames(file io.Reader, all bool) ([]image.Image, bool, error) {
+	g, err := gif.DecodeAll(file)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(g.Image) == 0 {
+		return nil, false, errNoFrames
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+
+	var frames []image.Image
+	for k, frame := range g.Image {
+		var previous *image.RGBA
+		disposal := byte(0)
+		if k < len(g.Disposal) {
+			disposal = g.Disposal[k]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = snapshot(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if k == 0 || (all && isFrameSampled(k, len(g.Image))) {
+			frames = append(frames, snapshot(canvas))
+		}
+		if !all && k == 0 {
+			break
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames, len(g.Image) > 1, nil
+}
+
+func isAnimatedPNG(file io.ReaderAt) bool {
+	reader := io.NewSectionReader(file, 0, 1<<62)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.Equal(header, pngSignature) {
+		return false
+	}
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return false
+		}
+		switch string(header[4:8]) {
+		case "acTL":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if _, err := reader.Seek(length+4, io.SeekCurrent); err != nil {
+			return false
+		}
+	}
+}
+
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+func readPNGChunks(file io.Reader) ([]pngChunk, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header, pngSignature) {
+		return nil, errBadPNG
+	}
+	var chunks []pngChunk
+	for {
+		if _, err := io.ReadFull(file, header); err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length > maxPNGChunk {
+			return nil, errBadPNG
+		}
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(file, data); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, pngChunk{kind: string(header[4:8]), data: data[:length]})
+		if string(header[4:8]) == "IEND" {
+			return chunks, nil
+		}
+	}
+}
+
+func writePNGChunk(out *bytes.Buffer, kind string, data []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(data)))
+	out.WriteString(kind)
+	out.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
+
+type apngFrame struct {
+	bounds  image.Rectangle
+	dispose byte
+	blend   byte
+	data    []byte
+}
+
+// decode wraps the frame's data in a PNG of its own, with the header and the
+// chunks that precede the animation, like the palette, of the whole file.
+func (f *apngFrame) decode(header []byte, shared []pngChunk) (image.Image, error) {
+	out := &bytes.Buffer{}
+	out.Write(pngSignature)
+	ihdr := append([]byte{}, header...)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(f.bounds.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(f.bounds.Dy()))
+	writePNGChunk(out, "IHDR", ihdr)
+	for _, chunk := range shared {
+		writePNGChunk(out, chunk.kind, chunk.data)
+	}
+	writePNGChunk(out, "IDAT", f.data)
+	writePNGChunk(out, "IEND", nil)
+	return png.Decode(out)
+}
+
+func decodeAPNGFrames(file io.Reader, all bool) ([]image.Image, bool, error) {
+	chunks, err := readPNGChunks(file)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var header []byte
+	var shared []pngChunk
+	var frames []*apngFrame
+	var current *apngFrame
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "IHDR":
+			header = chunk.data
+		case "fcTL":
+			if len(chunk.data) < 26 {
+				return nil, false, errBadPNG
+			}
+			x, y := int(binary.BigEndian.Uint32(chunk.data[12:16])), int(binary.BigEndian.Uint32(chunk.data[16:20]))
+			width, height := int(binary.BigEndian.Uint32(chunk.data[4:8])), int(binary.BigEndian.Uint32(chunk.data[8:12]))
+			current = &apngFrame{
+				bounds:  image.Rect(x, y, x+width, y+height),
+				dispose: chunk.data[24],
+				blend:   chunk.data[25],
+			}
+			frames = append(frames, current)
+		case "IDAT":
+			if current != nil {
+				current.data = append(current.data, chunk.data...)
+			}
+		case "fdAT":
+			if current != nil && len(chunk.data) >= 4 {
+				current.data = append(current.data, chunk.data[4:]...)
+			}
+		case "acTL", "IEND":
+		default:
+			if current == nil {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+	if len(header) < 13 || len(frames) == 0 {
+		return nil, false, errNoFrames
+	}
+
+	bounds := image.Rect(0, 0, int(binary.BigEndian.Uint32(header[0:4])), int(binary.BigEndian.Uint32(header[4:8])))
+	canvas := image.NewRGBA(bounds)
+
+	var images []image.Image
+	for k, frame := range frames {
+		img, err := frame.decode(header, shared)
+		if err != nil {
+			return nil, false, err
+		}
+		dispose := frame.dispose
+		if k == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+		var previous *image.RGBA
+		if dispose == apngDisposePrevious {
+			previous = snapshot(canvas)
+		}
+
+		op := draw.Over
+		if frame.blend == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, frame.bounds, img, img.Bounds().Min, op)
+		if k == 0 || (all && isFrameSampled(k, len(frames))) {
+			images = append(images, snapshot(canvas))
+		}
+		if !all && k == 0 {
+			break
+		}
+
+		switch dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, frame.bounds, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+	return images, len(frames) > 1, nil
+}
@@ -0,0 +1,112 @@
+package doubles
+
+import (
+	"bytes"
+	"doubles/phash"
+	. "doubles/types"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func grayImage(pixel func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{Y: pixel(x, y)})
+		}
+	}
+	return img
+}
+
+// encodeAPNG builds an animated PNG from full-size frames that replace each
+// other.
+func encodeAPNG(t *testing.T, frames []image.Image) []byte {
+	out := &bytes.Buffer{}
+	out.Write(pngSignature)
+	seq := uint32(0)
+	for k, frame := range frames {
+		encoded := &bytes.Buffer{}
+		if err := png.Encode(encoded, frame); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := readPNGChunks(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k == 0 {
+			writePNGChunk(out, "IHDR", chunks[0].data)
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl[0:4], uint32(len(frames)))
+			writePNGChunk(out, "acTL", actl)
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:4], seq)
+		binary.BigEndian.PutUint32(fctl[4:8], uint32(frame.Bounds().Dx()))
+		binary.BigEndian.PutUint32(fctl[8:12], uint32(frame.Bounds().Dy()))
+		writePNGChunk(out, "fcTL", fctl)
+		seq++
+
+		for _, chunk := range chunks {
+			if chunk.kind != "IDAT" {
+				continue
+			}
+			if k == 0 {
+				writePNGChunk(out, "IDAT", chunk.data)
+				continue
+			}
+			fdat := make([]byte, 4, 4+len(chunk.data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			writePNGChunk(out, "fdAT", append(fdat, chunk.data...))
+			seq++
+		}
+	}
+	writePNGChunk(out, "IEND", nil)
+	return out.Bytes()
+}
+
+func TestDecodeAPNGFrames(t *testing.T) {
+	sources := []image.Image{grayImage(rings), grayImage(stripes), grayImage(checkers)}
+	data := encodeAPNG(t, sources)
+
+	for _, all := range []bool{false, true} {
+		frames, animated, err := decodeAPNGFrames(bytes.NewReader(data), all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := sources[:1]
+		if all {
+			want = sources
+		}
+		if !animated || len(frames) != len(want) {
+			t.Fatalf("all=%v: got %d frames, animated %v, want %d", all, len(frames), animated, len(want))
+		}
+		for k := range want {
+			if got, expected := phash.NewGrid(frames[k]).Hash(), phash.NewGrid(want[k]).Hash(); got != expected {
+				t.Errorf("all=%v: frame %d hashed to %s, want %s", all, k, got, expected)
+			}
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "animated.png")
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	fingerprint, err := calculateFingerprint(file, "image/png", &Options{Frames: FramesAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fingerprint.Animated || len(fingerprint.Frames) != len(sources) {
+		t.Errorf("got animated %v with %d frame hashes, want %d", fingerprint.Animated, len(fingerprint.Frames), len(sources))
+	}
+}
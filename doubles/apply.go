@@ -0,0 +1,166 @@
+package doubles
+
+import (
+	"context"
+	"crypto/md5"
+	"doubles/colors"
+	"doubles/logger"
+	"doubles/report"
+	. "doubles/types"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	errChanged   = errors.New("File changed since scan")
+	errNoKeeper  = errors.New("Every member of the group is marked for deletion")
+	errKeeper    = errors.New("No kept copy of the group is still unchanged")
+	errInArchive = errors.New("Archive entries can not be deleted")
+)
+
+type ApplyResult struct {
+	Deleted   []string    `json:"deleted"`
+	Kept      int         `json:"kept"`
+	Skipped   []FileError `json:"skipped"`
+	Reclaimed int64       `json:"reclaimed_bytes"`
+}
+
+func contentHash(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func verifyMember(m report.Member) error {
+	info, err := os.Lstat(m.Path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Size() != m.Size {
+		return errChanged
+	}
+
+	hash, err := contentHash(m.Path)
+	if err != nil {
+		return err
+	}
+	if hash != m.Hash {
+		return errChanged
+	}
+	return nil
+}
+
+// archivedKeeper reports whether an archive that still exists holds an entry
+// identical to every loose member marked for deletion.
+func archivedKeeper(group report.Group) bool {
+	for _, m := range group.Members {
+		if len(m.Archive) == 0 {
+			continue
+		}
+		if _, err := os.Stat(m.Archive); err != nil {
+			continue
+		}
+		identical := true
+		for _, other := range group.Members {
+			if len(other.Archive) == 0 && other.ShouldDelete() && other.Hash != m.Hash {
+				identical = false
+			}
+		}
+		if identical {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyKeeper checks that a kept copy still exists unchanged before anything
+// in the group is deleted.
+func verifyKeeper(group report.Group) error {
+	err := errNoKeeper
+	for _, m := range group.Members {
+		if m.ShouldDelete() || len(m.Archive) > 0 {
+			continue
+		}
+		if verifyMember(m) == nil {
+			return nil
+		}
+		err = errKeeper
+	}
+	if archivedKeeper(group) {
+		return nil
+	}
+	return err
+}
+
+func applyGroup(ctx context.Context, group report.Group, result *ApplyResult) {
+	var keeper error
+	for _, m := range group.Members {
+		if m.ShouldDelete() && len(m.Archive) == 0 {
+			keeper = verifyKeeper(group)
+			break
+		}
+	}
+
+	for _, m := range group.Members {
+		if !m.ShouldDelete() {
+			result.Kept++
+			continue
+		}
+
+		var err error
+		switch {
+		case len(m.Archive) > 0:
+			err = errInArchive
+		case keeper != nil:
+			err = keeper
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		default:
+			if err = verifyMember(m); err == nil {
+				err = os.Remove(m.Path)
+			}
+		}
+
+		if err != nil {
+			result.Skipped = append(result.Skipped, FileError{Path: m.Path, Message: err.Error()})
+			continue
+		}
+		result.Deleted = append(result.Deleted, m.Path)
+		result.Reclaimed += m.Size
+	}
+}
+
+func Apply(ctx context.Context, groups []report.Group) *ApplyResult {
+	result := &ApplyResult{Deleted: []string{}, Skipped: []FileError{}}
+	for _, group := range groups {
+		applyGroup(ctx, group, result)
+	}
+	return result
+}
+
+func ApplyReport(ctx context.Context, options *Options) {
+	res, err := report.Load(options.Apply)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	printApplied(Apply(ctx, res.Groups))
+}
+
+func printApplied(result *ApplyResult) {
+	for _, skipped := range result.Skipped {
+		logger.Warnf("%s: %s", skipped.Path, skipped.Message)
+	}
+	fmt.Fprintf(os.Stdout, "\n\nDeleted %d file(s), kept %d, skipped %d\n",
+		colors.Bold(colors.Red(len(result.Deleted))), result.Kept, len(result.Skipped))
+	fmt.Fprintf(os.Stdout, "Reclaimed %d bytes\n", colors.Green(result.Reclaimed))
+}
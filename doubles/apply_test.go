@@ -0,0 +1,101 @@
+package doubles
+
+import (
+	"context"
+	"doubles/report"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newMember(t *testing.T, filename string, keep bool) report.Member {
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := contentHash(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report.Member{Path: filename, Size: info.Size(), Hash: hash, Keep: keep}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		keep    bool
+		change  func(keeper, copy string) error
+		deleted bool
+		message string
+	}{
+		{
+			name:    "unchanged",
+			keep:    true,
+			deleted: true,
+		},
+		{
+			name:    "missing keeper",
+			keep:    true,
+			change:  func(keeper, copy string) error { return os.Remove(keeper) },
+			message: errKeeper.Error(),
+		},
+		{
+			name:    "modified keeper",
+			keep:    true,
+			change:  func(keeper, copy string) error { return os.WriteFile(keeper, []byte("other"), 0644) },
+			message: errKeeper.Error(),
+		},
+		{
+			name:    "no keeper",
+			keep:    false,
+			message: errNoKeeper.Error(),
+		},
+		{
+			name:    "modified copy",
+			keep:    true,
+			change:  func(keeper, copy string) error { return os.WriteFile(copy, []byte("other"), 0644) },
+			message: errChanged.Error(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			keeper, copy := filepath.Join(dir, "keeper.txt"), filepath.Join(dir, "copy.txt")
+			writeFile(t, keeper, "same")
+			writeFile(t, copy, "same")
+			group := report.Group{ID: "g", Members: []report.Member{
+				newMember(t, keeper, test.keep),
+				newMember(t, copy, false),
+			}}
+			if test.change != nil {
+				if err := test.change(keeper, copy); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result := Apply(context.Background(), []report.Group{group})
+			_, err := os.Stat(copy)
+			if deleted := os.IsNotExist(err); deleted != test.deleted {
+				t.Fatalf("deleted is %v, want %v: %+v", deleted, test.deleted, result)
+			}
+			if test.deleted {
+				if len(result.Deleted) != 1 || result.Reclaimed != 4 {
+					t.Errorf("got %+v, want copy deleted", result)
+				}
+				return
+			}
+			var message string
+			for _, skipped := range result.Skipped {
+				if skipped.Path == copy {
+					message = skipped.Message
+				}
+			}
+			if message != test.message {
+				t.Errorf("got message %q, want %q", message, test.message)
+			}
+			if len(result.Deleted) != 0 {
+				t.Errorf("deleted %v", result.Deleted)
+			}
+		})
+	}
+}
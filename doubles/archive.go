@@ -0,0 +1,129 @@
+package doubles
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"doubles/metadata"
+	"doubles/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	archiveSeparator = "!/"
+	maxEntrySize     = 64 << 20
+)
+
+var archiveTypes = []string{"application/zip", "application/x-gzip", "application/x-tar"}
+
+func isArchive(mimeType string) bool {
+	return utils.InArray(mimeType, archiveTypes)
+}
+
+func (f *Finder) scanArchive(filename, mimeType string) error {
+	if mimeType == "application/zip" {
+		archive, err := zip.OpenReader(filename)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		for _, file := range archive.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			entry, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = f.addArchiveEntry(filename, file.Name, file.FileInfo(), entry)
+			entry.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if mimeType == "application/x-gzip" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := f.addArchiveEntry(filename, header.Name, header.FileInfo(), archive); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *Finder) addArchiveEntry(archive, name string, info os.FileInfo, entry io.Reader) error {
+	reader := bufio.NewReaderSize(entry, 512)
+	head, err := reader.Peek(512)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	mimeType := detectContentType(head)
+	if !utils.InArray(mimeType, f.mediaTypes) {
+		return nil
+	}
+
+	filename := archive + archiveSeparator + strings.TrimPrefix(name, "/")
+	hash := md5.New()
+
+	if info.Size() > maxEntrySize || !strings.HasPrefix(mimeType, "image/") {
+		if _, err := io.Copy(hash, reader); err != nil {
+			return err
+		}
+		f.images.AddArchiveEntry(filename, archive, info, mimeType, hash.Sum(nil))
+		f.found(filename)
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	hash.Write(data)
+	f.images.AddArchiveEntry(filename, archive, info, mimeType, hash.Sum(nil))
+	f.found(filename)
+
+	source := bytes.NewReader(data)
+	if m, err := metadata.Read(source, mimeType); err == nil {
+		f.images.SetMetadata(filename, m)
+	}
+	if f.options.Similar {
+		if fingerprint, err := calculateFingerprint(source, mimeType, f.options); err == nil {
+			f.images.AddFingerprint(filename, fingerprint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package doubles
+
+import (
+	"doubles/colors"
+	"doubles/database"
+	. "doubles/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const checkpointInterval = 30 * time.Second
+
+func isSameScan(a, b *Options) bool {
+	return a != nil && b != nil &&
+		strings.Join(scanRoots(a), "\x00") == strings.Join(scanRoots(b), "\x00") &&
+		strings.Join(a.Skip, "\x00") == strings.Join(b.Skip, "\x00") &&
+		a.Similar == b.Similar && a.Crops == b.Crops && a.Frames == b.Frames &&
+		a.Video == b.Video && a.Audio == b.Audio && a.Archives == b.Archives && a.Dirs == b.Dirs
+}
+
+func (f *Finder) loadCheckpoint() error {
+	if len(f.Checkpoint) == 0 {
+		return ErrNoCheckpoint
+	}
+	checkpoint, err := database.LoadCheckpoint(f.Checkpoint)
+	if os.IsNotExist(err) {
+		f.Log.Warnf("No checkpoint found, starting a new scan")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isSameScan(checkpoint.Options, f.options) {
+		return ErrCheckpoint
+	}
+
+	f.Log.Infof("Resuming from checkpoint of %s, %d file(s) already hashed",
+		checkpoint.Updated.Format(time.RFC3339), colors.Green(len(checkpoint.Files)))
+	f.resumed = checkpoint
+	return nil
+}
+
+func (f *Finder) resumeFile(filename string, info os.FileInfo) bool {
+	state, unchanged := f.resumed.Lookup(filename, info)
+	if !unchanged {
+		return false
+	}
+	f.images.Resume(state)
+	f.found(filename)
+	return true
+}
+
+func (f *Finder) resumeArchive(filename string, info os.FileInfo) bool {
+	entries, unchanged := f.resumed.Entries(filename, info)
+	if !unchanged {
+		return false
+	}
+	for _, state := range entries {
+		f.images.Resume(state)
+		f.found(state.Image.Path)
+	}
+	return true
+}
+
+func (f *Finder) requeue(image *Image) {
+	info, err := os.Stat(image.Path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	f.updateProgress(func(p *Progress) { p.Walked++ })
+	if !f.resumeFile(image.Path, info) {
+		f.images.AddFile(image.Path, info, image.MimeType)
+		f.found(image.Path)
+	}
+}
+
+func (f *Finder) rescanArchive(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil
+	}
+	f.updateProgress(func(p *Progress) { p.Walked++ })
+	if f.resumeArchive(filename, info) {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	mimeType, _, err := isMedia(file, nil)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return f.scanArchive(filename, mimeType)
+}
+
+func (f *Finder) resumeQueue(include func(filename string) bool) {
+	for _, state := range f.resumed.Files {
+		if len(state.Image.Archive) == 0 && include(state.Image.Path) {
+			f.requeue(state.Image)
+		}
+	}
+	for _, image := range f.resumed.Pending {
+		if include(image.Path) {
+			f.requeue(image)
+		}
+	}
+	for archive := range f.resumed.Archives {
+		if !include(archive) {
+			continue
+		}
+		if err := f.rescanArchive(archive); err != nil {
+			f.addError(archive, err)
+		}
+	}
+	for filename, other := range f.resumed.Others {
+		if include(filename) {
+			f.images.AddOtherFile(filename, other)
+		}
+	}
+}
+
+// resumeDirectories restores the files of directories the interrupted walk had
+// finished, so the new walk only descends into them to reach the rest.
+func (f *Finder) resumeDirectories() {
+	f.resumedDirs = make(map[string]bool, len(f.resumed.Walked))
+	for _, dir := range f.resumed.Walked {
+		f.resumedDirs[dir] = true
+	}
+	f.Log.Infof("Skipping %d directories walked before the interruption", colors.Green(len(f.resumedDirs)))
+	f.resumeQueue(func(filename string) bool {
+		return f.resumedDirs[filepath.Dir(filename)]
+	})
+}
+
+func (f *Finder) checkpoint(force bool) {
+	f.checkpoints.Lock()
+	defer f.checkpoints.Unlock()
+	if len(f.Checkpoint) == 0 || !force && time.Since(f.checkpointed) < checkpointInterval {
+		return
+	}
+	f.checkpointed = time.Now()
+
+	checkpoint := database.NewCheckpoint(f.options)
+	checkpoint.Walked = f.walkedDirectories()
+	checkpoint.Update(f.images.States(), nil, nil)
+	checkpoint.Scanned = f.scanned
+	checkpoint.Pending = f.images.Pending()
+	checkpoint.Others = f.images.OtherFiles()
+	if err := checkpoint.Save(f.Checkpoint); err != nil {
+		f.Log.Error(err)
+	}
+}
+
+func (f *Finder) removeCheckpoint() {
+	if len(f.Checkpoint) == 0 {
+		return
+	}
+	if err := os.Remove(f.Checkpoint); err != nil && !os.IsNotExist(err) {
+		f.Log.Error(err)
+	}
+}
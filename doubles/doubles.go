@@ -1,37 +1,79 @@
 package doubles
 
 import (
-	"crypto/md5"
+	"bytes"
+	"context"
+	"doubles/colors"
 	. "doubles/config"
+	"doubles/logger"
+	"doubles/metadata"
+	"doubles/phash"
+	"doubles/report"
 	. "doubles/types"
 	"doubles/utils"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
-	"path"
-	"path/filepath"
-	"sync"
-
-	colors "github.com/logrusorgru/aurora"
-	"github.com/schollz/progressbar"
+	"strings"
+	"time"
 )
 
 var (
-	wg     sync.WaitGroup
-	images = NewImageCollection()
+	ErrInvalidPath   = errors.New("Invalid path")
+	ErrInvalidKeep   = errors.New("Invalid keep policy")
+	ErrInvalidFrames = errors.New("Invalid frames mode")
+	ErrInvalidFormat = errors.New("Invalid report format")
+	ErrNoDatabase    = errors.New("Database file is not configured")
+	ErrNoCheckpoint  = errors.New("Checkpoint file is not configured")
+	ErrCheckpoint    = errors.New("Checkpoint was made with different scan options")
+	ErrStdout        = errors.New("Report output and event stream can not both go to stdout")
+)
+
+const (
+	summaryDirectories = 10
+	heatmapRows        = 20
+	directoryWidth     = 60
 )
 
-func isImage(file *os.File, imageTypes []string) (bool, error) {
+var heifBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"}
+
+func detectContentType(buffer []byte) string {
+	mimeType := http.DetectContentType(buffer)
+	if mimeType != "application/octet-stream" {
+		return mimeType
+	}
+	switch {
+	case bytes.HasPrefix(buffer, []byte("II*\x00")), bytes.HasPrefix(buffer, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(buffer) >= 12 && string(buffer[4:8]) == "ftyp" && utils.InArray(string(buffer[8:12]), heifBrands):
+		return "image/heic"
+	case len(buffer) >= 12 && string(buffer[4:12]) == "ftypqt  ":
+		return "video/quicktime"
+	case len(buffer) >= 262 && string(buffer[257:262]) == "ustar":
+		return "application/x-tar"
+	case bytes.HasPrefix(buffer, []byte("fLaC")):
+		return "audio/flac"
+	case len(buffer) >= 2 && buffer[0] == 0xff && buffer[1]&0xe0 == 0xe0:
+		return "audio/mpeg"
+	}
+	return mimeType
+}
+
+func isMedia(file *os.File, mediaTypes []string) (string, bool, error) {
 	buffer := make([]byte, 512)
-	if _, err := file.Read(buffer); err != nil {
-		return false, err
+	if _, err := file.Read(buffer); err == io.EOF {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
 	}
-	mimeType := http.DetectContentType(buffer)
-	return utils.InArray(mimeType, imageTypes), nil
+	mimeType := detectContentType(buffer)
+	return mimeType, utils.InArray(mimeType, mediaTypes), nil
 }
 
 func isPathValid(path string) bool {
@@ -39,142 +81,306 @@ func isPathValid(path string) bool {
 	return err == nil && st.IsDir()
 }
 
-func calculateHash(files <-chan string, results chan<- struct{}) {
-	for filename := range files {
-		file, err := os.Open(filename)
+func calculateFingerprint(file metadata.File, mimeType string, options *Options) (*phash.Fingerprint, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if mimeType == "image/gif" {
+		frames, animated, err := decodeGIFFrames(file, options.Frames == FramesAll)
 		if err != nil {
-			log.Fatal(colors.Red(err))
+			return nil, err
 		}
-
-		hash := md5.New()
-		if _, err := io.Copy(hash, file); err != nil {
-			log.Fatal(colors.Red(err))
+		fingerprint := phash.NewFingerprint(frames[0], options.Crops)
+		fingerprint.Animated = animated
+		if animated && options.Frames == FramesAll {
+			fingerprint.Frames = phash.FrameHashes(frames)
 		}
-		file.Close()
-
-		images.AddHash(hash.Sum(nil), filename)
-		results <- struct{}{}
+		return fingerprint, nil
 	}
-}
 
-func scan(dir string, skip, imageTypes []string) {
-	defer wg.Done()
-
-	visit := func(currentPath string, info os.FileInfo, err error) error {
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := phash.NewFingerprint(img, options.Crops)
+	fingerprint.Animated = mimeType == "image/png" && isAnimatedPNG(file)
+	if fingerprint.Animated && options.Frames == FramesAll {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		frames, _, err := decodeAPNGFrames(file, true)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		fingerprint.Frames = phash.FrameHashes(frames)
+	}
+	return fingerprint, nil
+}
 
-		if utils.InArray(path.Base(currentPath), skip) {
-			return filepath.SkipDir
+func (f *Finder) deleteDoubles(ctx context.Context, res *report.Report) (int, int, error) {
+	num, left := 0, 0
+	for _, group := range res.Groups {
+		for _, m := range group.Members {
+			if m.Keep || len(m.Archive) > 0 {
+				continue
+			}
+			if ctx.Err() != nil {
+				left++
+				continue
+			}
+			if err := os.Remove(m.Path); err != nil {
+				f.emit(Event{Type: EventError, Path: m.Path, Error: err.Error()})
+				return num, left, err
+			}
+			f.emit(Event{Type: EventActionApplied, Path: m.Path, Action: report.ActionDelete})
+			num++
 		}
+	}
+	return num, left, ctx.Err()
+}
 
-		if info.IsDir() && currentPath != dir {
-			wg.Add(1)
-			go scan(currentPath, skip, imageTypes)
-			return filepath.SkipDir
+func printDoubles(out io.Writer, group report.Group) {
+	fmt.Fprintln(out, groupPaths(group))
+	for _, m := range group.Members {
+		var details []string
+		if len(m.Transform) > 0 {
+			details = append(details, fmt.Sprintf("%s", colors.Cyan(m.Transform)))
 		}
+		if m.Metadata != nil {
+			details = append(details, fmt.Sprintf("%s", colors.Gray(m.Metadata)))
+		}
+		if len(details) > 0 {
+			fmt.Fprintf(out, "  %s: %s\n", m.Path, strings.Join(details, " "))
+		}
+	}
+}
 
-		if !info.IsDir() && info.Mode().IsRegular() {
-			file, err := os.Open(currentPath)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+func printDirectories(out io.Writer, doubles []DirectoryDoubles, subsets []DirectorySubset) {
+	fmt.Fprintf(out, "\n\nDuplicate directories found: %d\n", colors.Green(len(doubles)))
+	for _, d := range doubles {
+		fmt.Fprintf(out, "%s (%d files, %d bytes)\n", Doubles(d.Directories), d.Files, d.Size)
+	}
 
-			isImg, err := isImage(file, imageTypes)
-			if err != nil {
-				return err
-			}
-			if isImg {
-				images.AddFile(currentPath)
-			}
-		}
-		return nil
+	fmt.Fprintf(out, "\nContained directories found: %d\n", colors.Green(len(subsets)))
+	for _, s := range subsets {
+		fmt.Fprintf(out, "%s %s %s (%d files)\n", s.Directory, colors.Red("in"), s.Parent, s.Files)
 	}
+}
 
-	err := filepath.Walk(dir, visit)
-	if err != nil {
-		log.Fatal(colors.Red(err))
+func heatColor(percent int) interface{} {
+	text := fmt.Sprintf("%4d%%", percent)
+	switch {
+	case percent >= 75:
+		return colors.Red(text)
+	case percent >= 25:
+		return colors.Brown(text)
 	}
+	return colors.Green(text)
 }
 
-func deleteAllExceptFirst(doubles *map[string]Doubles) (int, error) {
-	num := 0
-	for _, list := range *doubles {
-		for _, filename := range list[1:] {
-			if err := os.Remove(filename); err != nil {
-				return 0, err
-			}
-			num++
+func shorten(path string, width int) string {
+	if len(path) <= width {
+		return path
+	}
+	return "..." + path[len(path)-width+3:]
+}
+
+func printHeatmap(out io.Writer, heatmap []report.DirectoryHeat) {
+	fmt.Fprintf(out, "\n\nDuplicate heatmap: %d directories\n", colors.Green(len(heatmap)))
+	if len(heatmap) == 0 {
+		return
+	}
+
+	width := len("DIRECTORY")
+	for k, d := range heatmap {
+		if k < heatmapRows && len(d.Directory) > width {
+			width = len(d.Directory)
+		}
+	}
+	if width > directoryWidth {
+		width = directoryWidth
+	}
+
+	fmt.Fprintf(out, "%-*s %6s %10s %5s %11s  %s\n", width, "DIRECTORY", "FILES", "DUPLICATED", "DUP", "RECLAIMABLE", "OVERLAPS WITH")
+	for k, d := range heatmap {
+		if k == heatmapRows {
+			fmt.Fprintf(out, "... and %d more\n", len(heatmap)-k)
+			break
+		}
+		var overlaps []string
+		for _, o := range d.Overlaps {
+			overlaps = append(overlaps, fmt.Sprintf("%s (%d)", o.Directory, o.Files))
 		}
+		fmt.Fprintf(out, "%-*s %6d %10d %s %11s  %s\n", width, shorten(d.Directory, width), d.Files, d.Duplicated,
+			heatColor(d.Percent()), report.FormatBytes(d.ReclaimableBytes), strings.Join(overlaps, ", "))
 	}
-	return num, nil
 }
 
-func Run(options *Options, config *Config) {
-	if !isPathValid(options.Directory) {
-		log.Fatal(colors.Red("Invalid path"))
+func seconds(duration float64) time.Duration {
+	return time.Duration(duration * float64(time.Second)).Round(time.Millisecond)
+}
+
+func printSummary(out io.Writer, res *report.Report) {
+	summary := res.Summary
+	fmt.Fprintf(out, "\n\nSummary\n")
+	fmt.Fprintf(out, "  Files scanned:    %d (%d walked, %d archive entries)\n", res.Totals.Files, summary.FilesWalked, res.Totals.ArchiveEntries)
+	fmt.Fprintf(out, "  Bytes hashed:     %s in %d file(s)\n", report.FormatBytes(summary.BytesHashed), summary.FilesHashed)
+	fmt.Fprintf(out, "  Groups:           %d\n", res.Totals.Groups)
+	fmt.Fprintf(out, "  Redundant copies: %d\n", colors.Brown(res.Totals.Redundant))
+	fmt.Fprintf(out, "  Reclaimable:      %s\n", colors.Green(report.FormatBytes(res.Totals.ReclaimableBytes)))
+
+	var phases []string
+	for _, phase := range summary.Phases {
+		phases = append(phases, fmt.Sprintf("%s %s", phase.Name, seconds(phase.Duration)))
 	}
+	fmt.Fprintf(out, "  Phases:           %s\n", strings.Join(phases, ", "))
 
-	fmt.Println("Scanning directory... ")
+	if len(summary.LargestGroups) > 0 {
+		paths := make(map[string]Doubles, len(res.Groups))
+		for _, group := range res.Groups {
+			paths[group.ID] = groupPaths(group)
+		}
+		fmt.Fprintf(out, "\nLargest groups\n")
+		for _, g := range summary.LargestGroups {
+			fmt.Fprintf(out, "  %s reclaimable, %d copies: %s\n",
+				colors.Green(report.FormatBytes(g.ReclaimableBytes)), g.Members, paths[g.ID])
+		}
+	}
 
-	wg.Add(1)
-	scan(options.Directory, options.Skip, config.ImageTypes)
-	wg.Wait()
+	if len(summary.Directories) > 0 {
+		fmt.Fprintf(out, "\nDirectories with most duplicates\n")
+		for k, d := range summary.Directories {
+			if k == summaryDirectories {
+				fmt.Fprintf(out, "  ... and %d more\n", len(summary.Directories)-k)
+				break
+			}
+			fmt.Fprintf(out, "  %s: %d duplicate(s), %d redundant, %s reclaimable\n",
+				d.Directory, d.Duplicates, d.Redundant, colors.Green(report.FormatBytes(d.ReclaimableBytes)))
+		}
+	}
+}
 
-	length := images.Length()
-	fmt.Printf("Images found: %d\n", colors.Green(length))
+func scanRoots(options *Options) []string {
+	var roots []string
+	if len(options.Directory) > 0 {
+		roots = append(roots, options.Directory)
+	}
+	return append(roots, options.Roots...)
+}
 
-	if length == 0 {
-		return
+func Validate(options *Options) error {
+	roots := scanRoots(options)
+	if len(roots) == 0 {
+		return ErrInvalidPath
+	}
+	for _, root := range roots {
+		if !isPathValid(root) {
+			return ErrInvalidPath
+		}
 	}
 
-	jobs := make(chan string, length)
-	results := make(chan struct{}, length)
+	if !isKeepPolicyValid(options.Keep) {
+		return ErrInvalidKeep
+	}
 
-	defer func() {
-		close(jobs)
-		close(results)
-	}()
+	if options.Frames != FramesFirst && options.Frames != FramesAll {
+		return ErrInvalidFrames
+	}
+
+	if !report.IsFormatValid(options.Format) {
+		return ErrInvalidFormat
+	}
 
-	fmt.Println("Calculating hashes... ")
-	bar := progressbar.New(length)
+	if options.Output == "-" && options.Stream == "-" {
+		return ErrStdout
+	}
+	return nil
+}
 
-	for w := 1; w <= 50; w++ {
-		go calculateHash(jobs, results)
+func newProgress(options *Options) Observer {
+	switch {
+	case options.Quiet:
+		return nil
+	case options.LogFormat == logger.FormatText && colors.IsTerminal(os.Stderr):
+		return NewProgressBar(os.Stderr)
 	}
+	return NewProgressLog(logger.Default(), progressLogInterval)
+}
 
-	for _, filename := range images.Files() {
-		jobs <- filename
+func Run(ctx context.Context, options *Options, config *Config) {
+	var out io.Writer = os.Stdout
+	if options.Output == "-" || options.Stream == "-" {
+		out = os.Stderr
 	}
 
-	for i := 1; i <= length; i++ {
-		<-results
-		if err := bar.Add(1); err != nil {
-			log.Println(err)
+	finder := NewFinder(options, config)
+	finder.Log = logger.Default()
+	finder.Checkpoint = config.CheckpointFile
+	if progress := newProgress(options); progress != nil {
+		finder.Subscribe(progress)
+	}
+	if len(options.Stream) > 0 {
+		var stream io.Writer = os.Stdout
+		if options.Stream != "-" {
+			file, err := os.Create(options.Stream)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			defer file.Close()
+			stream = file
 		}
+		finder.Subscribe(NewJSONStream(stream))
+	}
+	res, err := finder.FindContext(ctx)
+	if err != nil && res == nil {
+		logger.Fatal(err)
+	}
+	if res.Totals.Files == 0 && res.Totals.ArchiveEntries == 0 {
+		return
 	}
 
-	num, doubles := images.FindDoubles()
-	fmt.Printf("\n\nDoubles found: %d\n", num)
+	fmt.Fprintf(out, "\n\nDoubles found: %d group(s)\n", res.Totals.Groups)
+	for _, group := range res.Groups {
+		printDoubles(out, group)
+	}
+	if options.Dirs {
+		printDirectories(out, res.Directories, res.ContainedDirectories)
+	}
+	if options.Heatmap {
+		printHeatmap(out, res.Heatmap)
+	}
+	if res.Changes != nil {
+		printChanges(out, res.Changes)
+	}
+	printSummary(out, res)
 
 	if options.Dump {
-		data, _ := json.MarshalIndent(doubles, "", "\t")
-		if err := ioutil.WriteFile(config.DumpFile, data, 0644); err != nil {
-			log.Println(err)
+		if err := report.Save(config.DumpFile, res, options.Format); err != nil {
+			logger.Error(err)
+		}
+	}
+	if len(options.Output) > 0 {
+		if err := report.Save(options.Output, res, options.Format); err != nil {
+			logger.Error(err)
 		}
 	}
 
-	for _, list := range doubles {
-		fmt.Println(list)
+	if res.Run.Interrupted {
+		progress := finder.Progress()
+		logger.Warnf("Interrupted: hashed %d of %d file(s), results are incomplete and nothing was deleted", progress.Hashed, progress.Total)
+		logger.Warnf("Run again with -resume to continue from the checkpoint")
+		return
 	}
 
 	if options.Delete {
-		num, err := deleteAllExceptFirst(&doubles)
-		if err != nil {
-			log.Fatal(colors.Red(err))
+		num, left, err := finder.deleteDoubles(ctx, res)
+		if err != nil && err != ctx.Err() {
+			logger.Fatal(err)
+		}
+		fmt.Fprintf(out, "\n\nDeleted %d file(s)\n", colors.Bold(colors.Red(num)))
+		if left > 0 {
+			logger.Warnf("Interrupted: %d file(s) were not deleted", left)
 		}
-		fmt.Printf("\n\nDeleted %d file(s)\n", colors.Bold(colors.Red(num)))
 	}
 }
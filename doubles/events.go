@@ -0,0 +1,82 @@
+package doubles
+
+import (
+	"doubles/report"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+const (
+	EventWalkStarted    = "walk_started"
+	EventFileFound      = "file_found"
+	EventWalkFinished   = "walk_finished"
+	EventHashingStarted = "hashing_started"
+	EventFileHashed     = "file_hashed"
+	EventProgress       = "progress"
+	EventGroupFound     = "group_found"
+	EventActionApplied  = "action_applied"
+	EventError          = "error"
+	EventFinished       = "finished"
+)
+
+type Event struct {
+	Type     string        `json:"type"`
+	Time     time.Time     `json:"time"`
+	Path     string        `json:"path,omitempty"`
+	Group    *report.Group `json:"group,omitempty"`
+	Action   string        `json:"action,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Progress Progress      `json:"progress"`
+}
+
+type Observer interface {
+	Notify(event Event)
+}
+
+type ObserverFunc func(event Event)
+
+func (o ObserverFunc) Notify(event Event) {
+	o(event)
+}
+
+type jsonStream struct {
+	encoder *json.Encoder
+}
+
+func NewJSONStream(w io.Writer) Observer {
+	return &jsonStream{encoder: json.NewEncoder(w)}
+}
+
+func (s *jsonStream) Notify(event Event) {
+	s.encoder.Encode(event)
+}
+
+func (f *Finder) Subscribe(observer Observer) {
+	f.observers = append(f.observers, observer)
+}
+
+func (f *Finder) emit(event Event) {
+	if len(f.observers) == 0 {
+		return
+	}
+	event.Time = time.Now()
+	event.Progress = f.Progress()
+
+	f.events.Lock()
+	defer f.events.Unlock()
+	for _, observer := range f.observers {
+		observer.Notify(event)
+	}
+}
+
+func (f *Finder) found(filename string) {
+	f.updateProgress(func(p *Progress) { p.Found++ })
+	f.emit(Event{Type: EventFileFound, Path: filename})
+}
+
+func (f *Finder) addError(filename string, err error) {
+	f.images.AddError(filename, err)
+	f.Log.Debugf("%s: %s", filename, err)
+	f.emit(Event{Type: EventError, Path: filename, Error: err.Error()})
+}
@@ -0,0 +1,560 @@
+package doubles
+
+import (
+	"context"
+	"crypto/md5"
+	"doubles/audio"
+	"doubles/colors"
+	. "doubles/config"
+	"doubles/database"
+	"doubles/ffmpeg"
+	"doubles/logger"
+	"doubles/metadata"
+	"doubles/report"
+	. "doubles/types"
+	"doubles/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Finder struct {
+	Log          *logger.Logger
+	Checkpoint   string
+	options      *Options
+	config       *Config
+	mediaTypes   []string
+	decode       bool
+	images       *ImageCollection
+	previous     *database.Database
+	resumed      *database.Checkpoint
+	resumedDirs  map[string]bool
+	scanned      bool
+	walked       []string
+	checkpointed time.Time
+	checkpoints  sync.Mutex
+	wg           sync.WaitGroup
+	mux          sync.Mutex
+	failure      error
+	phases       []report.Phase
+	phaseStarted time.Time
+	observers    []Observer
+	events       sync.Mutex
+	progress     Progress
+}
+
+func NewFinder(options *Options, config *Config) *Finder {
+	return &Finder{
+		Log:      logger.New(ioutil.Discard),
+		options:  options,
+		config:   config,
+		images:   NewImageCollection(),
+		previous: database.New(),
+	}
+}
+
+func (f *Finder) fail(err error) {
+	f.mux.Lock()
+	if f.failure == nil {
+		f.failure = err
+	}
+	f.mux.Unlock()
+	f.emit(Event{Type: EventError, Error: err.Error()})
+}
+
+func (f *Finder) err() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.failure
+}
+
+func (f *Finder) updateProgress(update func(p *Progress)) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	update(&f.progress)
+}
+
+func (f *Finder) setPhase(phase string) {
+	now := time.Now()
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if len(f.progress.Phase) > 0 {
+		f.phases = append(f.phases, report.Phase{Name: f.progress.Phase, Duration: now.Sub(f.phaseStarted).Seconds()})
+	}
+	f.progress.Phase = phase
+	f.phaseStarted = now
+}
+
+func (f *Finder) Progress() Progress {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.progress
+}
+
+type byteCounter struct {
+	f *Finder
+}
+
+func (c byteCounter) Write(data []byte) (int, error) {
+	c.f.updateProgress(func(p *Progress) { p.HashedBytes += int64(len(data)) })
+	return len(data), nil
+}
+
+func (f *Finder) hashFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(hash, byteCounter{f}), file); err != nil {
+		return err
+	}
+
+	image := f.images.Image(filename)
+	switch {
+	case isTrack(image.MimeType):
+		if hash, err := audio.FrameHash(file, image.MimeType); err == nil {
+			f.images.AddTrack(filename, hash)
+		} else {
+			f.addError(filename, err)
+		}
+		if f.decode {
+			m, fingerprint, err := calculateTrackFingerprint(filename)
+			if m != nil {
+				f.images.SetMetadata(filename, m)
+			}
+			if err == nil {
+				f.images.AddTrackFingerprint(filename, fingerprint)
+			} else {
+				f.addError(filename, err)
+			}
+		}
+	case isVideo(image.MimeType):
+		if f.decode {
+			m, frames, err := calculateVideoFingerprint(filename)
+			if m != nil {
+				f.images.SetMetadata(filename, m)
+			}
+			if err == nil {
+				f.images.AddVideoFingerprint(filename, frames)
+			} else {
+				f.addError(filename, err)
+			}
+		}
+	default:
+		if m, err := metadata.Read(file, image.MimeType); err == nil {
+			f.images.SetMetadata(filename, m)
+		}
+	}
+
+	if f.options.Similar && strings.HasPrefix(image.MimeType, "image/") {
+		if fingerprint, err := calculateFingerprint(file, image.MimeType, f.options); err == nil {
+			f.images.AddFingerprint(filename, fingerprint)
+		} else {
+			f.addError(filename, err)
+		}
+	}
+
+	f.images.AddHash(hash.Sum(nil), filename)
+	return nil
+}
+
+func (f *Finder) calculateHash(ctx context.Context, files <-chan string, results chan<- struct{}) {
+	for filename := range files {
+		if ctx.Err() != nil {
+			results <- struct{}{}
+			continue
+		}
+		if err := f.hashFile(filename); err != nil {
+			f.skipFile(filename, err)
+		}
+		f.updateProgress(func(p *Progress) { p.Hashed++ })
+		f.emit(Event{Type: EventFileHashed, Path: filename})
+		results <- struct{}{}
+	}
+}
+
+// skipFile drops a file that could not be hashed and reports it, keeping it in
+// directory digests so its directory does not look like a copy of another.
+func (f *Finder) skipFile(filename string, err error) {
+	var size int64
+	if image := f.images.Image(filename); image != nil {
+		size = image.Size
+	}
+	f.images.Remove(filename)
+	f.addUnreadable(filename, size, err)
+}
+
+func (f *Finder) addUnreadable(filename string, size int64, err error) {
+	f.addError(filename, err)
+	if f.options.Dirs {
+		f.images.AddOtherFile(filename, OtherFile{Size: size, Hash: "unreadable:" + filename})
+	}
+}
+
+func (f *Finder) scan(ctx context.Context, dir string) {
+	defer f.wg.Done()
+
+	if f.resumedDirs[dir] {
+		if err := f.scanSubdirectories(ctx, dir); err != nil {
+			if err != ctx.Err() {
+				f.addUnreadable(dir, 0, err)
+			}
+			return
+		}
+		f.finishDirectory(ctx, dir)
+		return
+	}
+
+	visit := func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			f.addUnreadable(currentPath, 0, err)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if utils.InArray(path.Base(currentPath), f.options.Skip) {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && currentPath != dir {
+			f.wg.Add(1)
+			go f.scan(ctx, currentPath)
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && info.Mode().IsRegular() {
+			f.updateProgress(func(p *Progress) { p.Walked++ })
+			if f.resumed != nil && f.resumeFile(currentPath, info) {
+				return nil
+			}
+			if f.options.Incremental && f.restoreFile(currentPath, info) {
+				return nil
+			}
+
+			file, err := os.Open(currentPath)
+			if err != nil {
+				f.addUnreadable(currentPath, info.Size(), err)
+				return nil
+			}
+			defer file.Close()
+
+			mimeType, ok, err := isMedia(file, f.mediaTypes)
+			if err != nil {
+				f.addUnreadable(currentPath, info.Size(), err)
+				return nil
+			}
+			if !ok && f.options.Dirs {
+				f.images.AddOtherFile(currentPath, OtherFile{Size: info.Size()})
+			}
+			if ok {
+				f.images.AddFile(currentPath, info, mimeType)
+				f.found(currentPath)
+			} else if f.options.Archives && isArchive(mimeType) {
+				if f.resumed != nil && f.resumeArchive(currentPath, info) {
+					return nil
+				}
+				if f.options.Incremental && f.restoreArchive(currentPath, info) {
+					return nil
+				}
+				if err := f.scanArchive(currentPath, mimeType); err != nil {
+					f.addError(currentPath, err)
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := filepath.Walk(dir, visit); err != nil {
+		if err != ctx.Err() {
+			f.fail(err)
+		}
+		return
+	}
+	f.finishDirectory(ctx, dir)
+}
+
+func (f *Finder) scanSubdirectories(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() && !utils.InArray(entry.Name(), f.options.Skip) {
+			f.wg.Add(1)
+			go f.scan(ctx, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+func (f *Finder) finishDirectory(ctx context.Context, dir string) {
+	if ctx.Err() != nil {
+		return
+	}
+	f.mux.Lock()
+	f.walked = append(f.walked, dir)
+	f.mux.Unlock()
+	f.checkpoint(false)
+}
+
+func (f *Finder) walkedDirectories() []string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]string{}, f.walked...)
+}
+
+func (f *Finder) hashFiles(ctx context.Context, length int) {
+	jobs := make(chan string, length)
+	results := make(chan struct{}, length)
+
+	defer func() {
+		close(jobs)
+		close(results)
+	}()
+
+	f.Log.Infof("Calculating hashes")
+	f.emit(Event{Type: EventHashingStarted})
+
+	for w := 1; w <= 50; w++ {
+		go f.calculateHash(ctx, jobs, results)
+	}
+
+	for _, filename := range f.images.Files() {
+		jobs <- filename
+	}
+
+	for i := 1; i <= length; i++ {
+		<-results
+		f.checkpoint(false)
+	}
+}
+
+func (f *Finder) prepare(ctx context.Context) error {
+	if err := Validate(f.options); err != nil {
+		return err
+	}
+
+	f.mediaTypes = append([]string{}, f.config.ImageTypes...)
+	if f.options.Video {
+		f.mediaTypes = append(f.mediaTypes, f.config.VideoTypes...)
+	}
+	if f.options.Audio {
+		f.mediaTypes = append(f.mediaTypes, f.config.AudioTypes...)
+	}
+
+	f.decode = false
+	if f.options.Video || f.options.Audio {
+		if f.decode = ffmpeg.Available(); !f.decode {
+			f.Log.Warnf("ffmpeg not found, videos will be compared by content and tracks by audio frames")
+		}
+	}
+
+	if f.options.Incremental {
+		if len(f.config.DatabaseFile) == 0 {
+			return ErrNoDatabase
+		}
+		db, err := database.Load(f.config.DatabaseFile)
+		if err != nil {
+			return err
+		}
+		f.previous = db
+	}
+
+	if f.options.Resume {
+		if err := f.loadCheckpoint(); err != nil {
+			return err
+		}
+	}
+
+	f.setPhase(phaseScanning)
+	for _, root := range scanRoots(f.options) {
+		f.Log.Debugf("Walking %s", root)
+		f.emit(Event{Type: EventWalkStarted, Path: root})
+	}
+	if f.resumed != nil && f.resumed.Scanned {
+		f.Log.Infof("Restoring file list from checkpoint")
+		f.resumeQueue(func(string) bool { return true })
+	} else {
+		if f.resumed != nil && len(f.resumed.Walked) > 0 {
+			f.resumeDirectories()
+		}
+		f.Log.Infof("Scanning directory")
+		for _, root := range scanRoots(f.options) {
+			f.wg.Add(1)
+			f.scan(ctx, root)
+		}
+		f.wg.Wait()
+	}
+	f.emit(Event{Type: EventWalkFinished})
+	if err := f.err(); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	f.scanned = true
+	f.checkpoint(false)
+
+	f.Log.Infof("Files found: %d", colors.Green(f.images.Length()))
+	if f.options.Archives {
+		f.Log.Infof("Archive entries found: %d", colors.Green(f.images.ArchiveEntries()))
+	}
+
+	pending := len(f.images.Files())
+	var size int64
+	for _, filename := range f.images.Files() {
+		size += f.images.Image(filename).Size
+	}
+	f.setPhase(phaseHashing)
+	f.updateProgress(func(p *Progress) {
+		p.Total = pending
+		p.TotalBytes = size
+	})
+	if pending > 0 {
+		f.hashFiles(ctx, pending)
+	}
+	return f.err()
+}
+
+func (f *Finder) findGroups(ctx context.Context, started time.Time) *report.Report {
+	f.setPhase(phaseGrouping)
+
+	var doubles map[string]Doubles
+	if f.options.Similar {
+		_, doubles = f.images.FindSimilar(f.options)
+	} else {
+		_, doubles = f.images.FindDoubles()
+	}
+
+	if f.options.Video && f.decode {
+		_, videoDoubles := f.images.FindVideos(f.options.Threshold)
+		for k, v := range videoDoubles {
+			doubles[k] = v
+		}
+	}
+
+	if f.options.Audio {
+		_, trackDoubles := f.images.FindTracks(f.options.TrackThreshold)
+		for k, v := range trackDoubles {
+			doubles[k] = v
+		}
+	}
+
+	res := f.buildReport(doubles, started)
+	res.Run.Interrupted = ctx.Err() != nil
+	for k := range res.Groups {
+		f.emit(Event{Type: EventGroupFound, Group: &res.Groups[k]})
+	}
+	if f.options.Dirs && !res.Run.Interrupted {
+		f.hashOtherFiles(ctx)
+		for _, root := range scanRoots(f.options) {
+			directories, subsets := f.images.FindDirectories(root)
+			res.Directories = append(res.Directories, directories...)
+			res.ContainedDirectories = append(res.ContainedDirectories, subsets...)
+		}
+	}
+	if f.options.Heatmap {
+		res.BuildHeatmap(f.images.DirectoryFiles())
+	}
+	return res
+}
+
+func (f *Finder) hashOtherFiles(ctx context.Context) {
+	for filename, other := range f.images.OtherFiles() {
+		if ctx.Err() != nil {
+			return
+		}
+		if len(other.Hash) > 0 {
+			continue
+		}
+		hash, err := contentHash(filename)
+		if err != nil {
+			f.addError(filename, err)
+			hash = "unreadable:" + filename
+		}
+		other.Hash = hash
+		f.images.AddOtherFile(filename, other)
+	}
+}
+
+func (f *Finder) finish(res *report.Report, phase string) {
+	f.setPhase(phase)
+	f.mux.Lock()
+	progress := f.progress
+	phases := append([]report.Phase{}, f.phases...)
+	f.mux.Unlock()
+
+	res.Summarize(progress.Walked, progress.Hashed, progress.HashedBytes, phases)
+	f.emit(Event{Type: EventFinished})
+}
+
+func (f *Finder) tick(done <-chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			f.emit(Event{Type: EventProgress})
+		}
+	}
+}
+
+func (f *Finder) Find() (*report.Report, error) {
+	return f.FindContext(context.Background())
+}
+
+func (f *Finder) FindContext(ctx context.Context) (*report.Report, error) {
+	started := time.Now()
+	f.images = NewImageCollection()
+	f.previous = database.New()
+	f.resumed = nil
+	f.resumedDirs = nil
+	f.scanned = false
+	f.checkpointed = started
+	f.mux.Lock()
+	f.failure = nil
+	f.walked = nil
+	f.progress = Progress{}
+	f.phases = nil
+	f.mux.Unlock()
+
+	done := make(chan struct{})
+	defer close(done)
+	go f.tick(done)
+
+	if err := f.prepare(ctx); err != nil {
+		return nil, err
+	}
+
+	res := f.findGroups(ctx, started)
+	if f.options.Incremental {
+		if err := f.updateDatabase(res); err != nil {
+			return nil, err
+		}
+	}
+
+	res.Finish()
+	if res.Run.Interrupted {
+		f.checkpoint(true)
+		f.finish(res, phaseInterrupted)
+		return res, ctx.Err()
+	}
+	f.removeCheckpoint()
+	f.finish(res, phaseDone)
+	return res, nil
+}
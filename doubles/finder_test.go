@@ -0,0 +1,167 @@
+package doubles
+
+import (
+	. "doubles/config"
+	"doubles/report"
+	. "doubles/types"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeImage(t *testing.T, filename string, pixel func(x, y int) uint8) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, grayImage(pixel)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, filename, content string) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkers(x, y int) uint8 {
+	if (x/16+y/16)%2 == 0 {
+		return 200
+	}
+	return 40
+}
+
+func stripes(x, y int) uint8 {
+	if (x/8)%2 == 0 {
+		return 220
+	}
+	return 30
+}
+
+func rings(x, y int) uint8 {
+	dx, dy := x-32, y-32
+	return uint8((dx*dx + dy*dy) / 4 % 256)
+}
+
+func noisyRings(x, y int) uint8 {
+	if (x*7+y*3)%11 == 0 {
+		return rings(x, y) ^ 4
+	}
+	return rings(x, y)
+}
+
+// newFixture lays out copies, a similar image and directories of which d1 and
+// d2 are identical while d3 differs in a file that is not an image.
+func newFixture(t *testing.T) string {
+	root := t.TempDir()
+	writeImage(t, filepath.Join(root, "a.png"), rings)
+	writeImage(t, filepath.Join(root, "copy", "a.png"), rings)
+	writeImage(t, filepath.Join(root, "b.png"), noisyRings)
+	writeImage(t, filepath.Join(root, "c.png"), checkers)
+	for _, dir := range []string{"d1", "d2", "d3"} {
+		writeImage(t, filepath.Join(root, dir, "x.png"), stripes)
+	}
+	writeFile(t, filepath.Join(root, "d1", "notes.txt"), "one")
+	writeFile(t, filepath.Join(root, "d2", "notes.txt"), "one")
+	writeFile(t, filepath.Join(root, "d3", "notes.txt"), "two")
+	writeFile(t, filepath.Join(root, "d3", "empty.txt"), "")
+	return root
+}
+
+func relativeGroups(root string, groups []report.Group) [][]string {
+	var list [][]string
+	for _, g := range groups {
+		var paths []string
+		for _, m := range g.Members {
+			paths = append(paths, strings.TrimPrefix(m.Path, root+"/"))
+		}
+		sort.Strings(paths)
+		list = append(list, paths)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a][0] < list[b][0] })
+	return list
+}
+
+func TestFinderFind(t *testing.T) {
+	root := newFixture(t)
+	config := &Config{ImageTypes: []string{"image/png"}}
+
+	tests := []struct {
+		name        string
+		options     Options
+		groups      [][]string
+		directories [][]string
+	}{
+		{
+			name:    "exact",
+			options: Options{},
+			groups: [][]string{
+				{"a.png", "copy/a.png"},
+				{"d1/x.png", "d2/x.png", "d3/x.png"},
+			},
+		},
+		{
+			name:    "similar",
+			options: Options{Similar: true, Threshold: 10},
+			groups: [][]string{
+				{"a.png", "b.png", "copy/a.png"},
+				{"d1/x.png", "d2/x.png", "d3/x.png"},
+			},
+		},
+		{
+			name:    "dirs",
+			options: Options{Dirs: true},
+			groups: [][]string{
+				{"a.png", "copy/a.png"},
+				{"d1/x.png", "d2/x.png", "d3/x.png"},
+			},
+			directories: [][]string{{"d1", "d2"}},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			options := test.options
+			options.Directory = root
+			options.Keep = KeepFirst
+			options.Frames = FramesFirst
+			options.Format = FormatJSON
+
+			res, err := NewFinder(&options, config).Find()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if groups := relativeGroups(root, res.Groups); !reflect.DeepEqual(groups, test.groups) {
+				t.Errorf("got groups %v, want %v", groups, test.groups)
+			}
+
+			var directories [][]string
+			for _, d := range res.Directories {
+				var paths []string
+				for _, path := range d.Directories {
+					paths = append(paths, strings.TrimPrefix(path, root+"/"))
+				}
+				directories = append(directories, paths)
+			}
+			if !reflect.DeepEqual(directories, test.directories) {
+				t.Errorf("got directories %v, want %v", directories, test.directories)
+			}
+			if len(res.Errors) > 0 {
+				t.Errorf("got errors %v", res.Errors)
+			}
+		})
+	}
+}
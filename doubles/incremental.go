@@ -0,0 +1,170 @@
+package doubles
+
+import (
+	"doubles/colors"
+	"doubles/database"
+	"doubles/report"
+	. "doubles/types"
+	"doubles/utils"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+func isComplete(state *FileState, options *Options, decode bool) bool {
+	image := state.Image
+	if len(image.Archive) == 0 {
+		switch {
+		case isTrack(image.MimeType):
+			return len(state.Track) > 0 && (!decode || state.TrackPrint != nil)
+		case isVideo(image.MimeType):
+			return !decode || state.Frames != nil
+		}
+	}
+
+	if !options.Similar || !strings.HasPrefix(image.MimeType, "image/") {
+		return true
+	}
+	fingerprint := state.Fingerprint
+	if fingerprint == nil {
+		return len(image.Archive) > 0 && image.Size > maxEntrySize
+	}
+	if options.Crops && len(fingerprint.Crops) == 0 {
+		return false
+	}
+	return options.Frames != FramesAll || !fingerprint.Animated || len(fingerprint.Frames) > 0
+}
+
+func (f *Finder) restoreState(state *FileState) {
+	if !f.decode {
+		stripped := *state
+		stripped.Frames, stripped.TrackPrint = nil, nil
+		state = &stripped
+	}
+	f.images.Restore(state)
+	f.found(state.Image.Path)
+}
+
+func (f *Finder) restoreFile(filename string, info os.FileInfo) bool {
+	state, unchanged := f.previous.Lookup(filename, info)
+	if !unchanged || !isComplete(state, f.options, f.decode) {
+		return false
+	}
+	if utils.InArray(state.Image.MimeType, f.mediaTypes) {
+		f.restoreState(state)
+	} else if f.options.Dirs {
+		f.images.AddOtherFile(filename, OtherFile{Size: info.Size(), Hash: state.Image.Hash})
+	}
+	return true
+}
+
+func (f *Finder) restoreArchive(filename string, info os.FileInfo) bool {
+	entries, unchanged := f.previous.Entries(filename, info)
+	if !unchanged {
+		return false
+	}
+	for _, state := range entries {
+		if !isComplete(state, f.options, f.decode) {
+			return false
+		}
+	}
+	for _, state := range entries {
+		if utils.InArray(state.Image.MimeType, f.mediaTypes) {
+			f.restoreState(state)
+		}
+	}
+	return true
+}
+
+func isUnderRoots(filename string, roots []string) bool {
+	for _, root := range roots {
+		if database.IsUnder(filename, root) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupIDs(res *report.Report) []string {
+	ids := make([]string, 0, len(res.Groups))
+	for _, g := range res.Groups {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+func (f *Finder) diffDatabase(states map[string]*FileState, groups []string) *report.Changes {
+	roots := scanRoots(f.options)
+	changes := &report.Changes{
+		Since:          f.previous.Updated,
+		New:            []string{},
+		Modified:       []string{},
+		Deleted:        []string{},
+		NewGroups:      []string{},
+		ResolvedGroups: []string{},
+	}
+
+	for filename := range states {
+		if _, ok := f.previous.Files[filename]; !ok {
+			changes.New = append(changes.New, filename)
+		} else if !f.images.IsRestored(filename) {
+			changes.Modified = append(changes.Modified, filename)
+		}
+	}
+	for filename, state := range f.previous.Files {
+		if _, ok := states[filename]; ok || !isUnderRoots(filename, roots) {
+			continue
+		}
+		if !f.previous.Exists(state) {
+			changes.Deleted = append(changes.Deleted, filename)
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, id := range f.previous.Groups {
+		known[id] = true
+	}
+	for _, id := range groups {
+		if !known[id] {
+			changes.NewGroups = append(changes.NewGroups, id)
+		}
+		delete(known, id)
+	}
+	for id := range known {
+		changes.ResolvedGroups = append(changes.ResolvedGroups, id)
+	}
+
+	for _, list := range [][]string{changes.New, changes.Modified, changes.Deleted, changes.NewGroups, changes.ResolvedGroups} {
+		sort.Strings(list)
+	}
+	return changes
+}
+
+func printChanges(out io.Writer, changes *report.Changes) {
+	fmt.Fprintf(out, "\n\nChanges since last run: %d new, %d modified, %d deleted\n",
+		colors.Green(len(changes.New)), colors.Brown(len(changes.Modified)), colors.Red(len(changes.Deleted)))
+	for _, filename := range changes.New {
+		fmt.Fprintf(out, "  %s %s\n", colors.Green("+"), filename)
+	}
+	for _, filename := range changes.Modified {
+		fmt.Fprintf(out, "  %s %s\n", colors.Brown("~"), filename)
+	}
+	for _, filename := range changes.Deleted {
+		fmt.Fprintf(out, "  %s %s\n", colors.Red("-"), filename)
+	}
+	fmt.Fprintf(out, "Groups: %d new, %d resolved\n", colors.Green(len(changes.NewGroups)), colors.Green(len(changes.ResolvedGroups)))
+}
+
+func (f *Finder) updateDatabase(res *report.Report) error {
+	states := f.images.States()
+	groups := groupIDs(res)
+	if res.Run.Interrupted {
+		groups = f.previous.Groups
+	}
+	res.Changes = f.diffDatabase(states, groups)
+
+	f.previous.Update(states, res.Changes.Deleted, groups)
+	return f.previous.Save(f.config.DatabaseFile)
+}
@@ -0,0 +1,96 @@
+package doubles
+
+import (
+	. "doubles/types"
+)
+
+var keepPolicies = map[string]func(images []*Image) int{
+	KeepFirst: func(images []*Image) int {
+		return 0
+	},
+	KeepMetadata: func(images []*Image) int {
+		keep, best := 0, -1
+		for k, image := range images {
+			score := 0
+			if image.Metadata != nil {
+				score = image.Metadata.Completeness()
+			}
+			if score > best {
+				keep, best = k, score
+			}
+		}
+		return keep
+	},
+	KeepLargest: func(images []*Image) int {
+		keep := 0
+		for k, image := range images {
+			if compareResolution(image, images[keep]) > 0 {
+				keep = k
+			}
+		}
+		return keep
+	},
+}
+
+func resolution(image *Image) int {
+	if image.Metadata == nil {
+		return 0
+	}
+	return image.Metadata.Width * image.Metadata.Height
+}
+
+func compareResolution(a, b *Image) int64 {
+	if diff := resolution(a) - resolution(b); diff != 0 {
+		return int64(diff)
+	}
+	return a.Size - b.Size
+}
+
+func isKeepPolicyValid(policy string) bool {
+	_, ok := keepPolicies[policy]
+	return ok
+}
+
+// archivedCopies reports whether every loose image is byte for byte identical
+// to an archive entry, which is the only case where the archive may stand in
+// for the kept copy.
+func archivedCopies(archived, loose []*Image) bool {
+	hashes := make(map[string]bool)
+	for _, image := range archived {
+		if len(image.Hash) > 0 {
+			hashes[image.Hash] = true
+		}
+	}
+	for _, image := range loose {
+		if !hashes[image.Hash] {
+			return false
+		}
+	}
+	return true
+}
+
+func planGroup(members []*Image, policy string, archiveKeeps bool) (string, Doubles) {
+	var loose, archived []*Image
+	for _, image := range members {
+		if len(image.Archive) > 0 {
+			archived = append(archived, image)
+		} else {
+			loose = append(loose, image)
+		}
+	}
+	if len(loose) == 0 {
+		return "", nil
+	}
+
+	keeper := loose[keepPolicies[policy](loose)].Path
+	if archiveKeeps && len(archived) > 0 && archivedCopies(archived, loose) {
+		keeper = ""
+	}
+	var removable Doubles
+	for _, image := range loose {
+		if image.Path != keeper {
+			removable = append(removable, image.Path)
+		}
+	}
+	return keeper, removable
+}
@@ -0,0 +1,72 @@
+package doubles
+
+import (
+	"doubles/audio"
+	"doubles/ffmpeg"
+	"doubles/metadata"
+	"doubles/phash"
+	"errors"
+	"strings"
+)
+
+const frameInterval = 2.0
+
+var (
+	errNoVideoFrames = errors.New("No frames extracted, compared by content hash only")
+	errUniformVideo  = errors.New("Frames are blank, constant or too few to compare, compared by content hash only")
+)
+
+func isVideo(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/")
+}
+
+func calculateVideoFingerprint(filename string) (*metadata.Metadata, []phash.Hash, error) {
+	info, err := ffmpeg.Probe(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	frames, err := ffmpeg.GrayFrames(filename, frameInterval, phash.GridSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]phash.Hash, 0, len(frames))
+	for _, frame := range frames {
+		hashes = append(hashes, phash.NewGridFromGray(frame).Hash())
+	}
+
+	m := &metadata.Metadata{
+		Width:    info.Width,
+		Height:   info.Height,
+		Duration: info.Duration,
+	}
+	if len(hashes) == 0 {
+		return m, nil, errNoVideoFrames
+	}
+	if phash.Distinct(hashes) < 2 {
+		return m, nil, errUniformVideo
+	}
+	return m, hashes, nil
+}
+
+const sampleRate = 8000
+
+var errNoEnvelope = errors.New("Track is too short, silent or flat to compare by sound")
+
+func isTrack(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "audio/") || mimeType == "application/ogg"
+}
+
+func calculateTrackFingerprint(filename string) (*metadata.Metadata, phash.Hash, error) {
+	samples, err := ffmpeg.PCM(filename, sampleRate)
+	if err != nil {
+		return nil, 0, err
+	}
+	m := &metadata.Metadata{Duration: float64(len(samples)) / sampleRate}
+	fingerprint, ok := audio.Fingerprint(samples)
+	if !ok {
+		return m, 0, errNoEnvelope
+	}
+	return m, fingerprint, nil
+}
@@ -0,0 +1,132 @@
+package doubles
+
+import (
+	"doubles/logger"
+	"doubles/report"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/schollz/progressbar"
+)
+
+const (
+	phaseScanning    = "scanning"
+	phaseHashing     = "hashing"
+	phaseGrouping    = "grouping"
+	phaseDone        = "done"
+	phaseInterrupted = "interrupted"
+)
+
+const (
+	progressInterval    = time.Second
+	progressLogInterval = 10 * time.Second
+	counterThrottle     = 100 * time.Millisecond
+)
+
+type Progress struct {
+	Phase       string `json:"phase"`
+	Walked      int    `json:"walked"`
+	Found       int    `json:"found"`
+	Hashed      int    `json:"hashed"`
+	Total       int    `json:"total"`
+	HashedBytes int64  `json:"hashed_bytes"`
+	TotalBytes  int64  `json:"total_bytes"`
+}
+
+func (p Progress) Percent() int {
+	if p.TotalBytes > 0 {
+		return int(p.HashedBytes * 100 / p.TotalBytes)
+	}
+	if p.Total > 0 {
+		return p.Hashed * 100 / p.Total
+	}
+	return 0
+}
+
+func throughput(p Progress, elapsed time.Duration) (float64, time.Duration) {
+	if elapsed <= 0 || p.HashedBytes == 0 {
+		return 0, 0
+	}
+	rate := float64(p.HashedBytes) / elapsed.Seconds()
+	left := time.Duration(float64(p.TotalBytes-p.HashedBytes) / rate * float64(time.Second))
+	return rate, left.Round(time.Second)
+}
+
+type progressBar struct {
+	out     io.Writer
+	bar     *progressbar.ProgressBar
+	counted time.Time
+}
+
+func NewProgressBar(out io.Writer) Observer {
+	return &progressBar{out: out}
+}
+
+func (p *progressBar) count(progress Progress) {
+	fmt.Fprintf(p.out, "\rScanning: %d files walked, %d found", progress.Walked, progress.Found)
+}
+
+func (p *progressBar) Notify(event Event) {
+	progress := event.Progress
+	switch event.Type {
+	case EventFileFound, EventProgress:
+		if progress.Phase == phaseScanning && event.Time.Sub(p.counted) >= counterThrottle {
+			p.counted = event.Time
+			p.count(progress)
+		}
+		if progress.Phase == phaseHashing && p.bar != nil {
+			p.bar.Set64(progress.HashedBytes)
+		}
+	case EventWalkFinished:
+		p.count(progress)
+		fmt.Fprintln(p.out)
+	case EventHashingStarted:
+		if progress.TotalBytes > 0 {
+			p.bar = progressbar.NewOptions64(progress.TotalBytes,
+				progressbar.OptionSetWriter(p.out),
+				progressbar.OptionSetBytes64(progress.TotalBytes),
+				progressbar.OptionThrottle(counterThrottle))
+		}
+	case EventFileHashed:
+		if p.bar != nil {
+			p.bar.Set64(progress.HashedBytes)
+		}
+	}
+}
+
+type progressLog struct {
+	log      *logger.Logger
+	interval time.Duration
+	logged   time.Time
+	started  time.Time
+}
+
+func NewProgressLog(log *logger.Logger, interval time.Duration) Observer {
+	return &progressLog{log: log, interval: interval, logged: time.Now()}
+}
+
+func (p *progressLog) Notify(event Event) {
+	progress := event.Progress
+	switch event.Type {
+	case EventHashingStarted:
+		p.started = event.Time
+		p.log.Infof("Hashing %d file(s), %s", progress.Total, report.FormatBytes(progress.TotalBytes))
+	case EventProgress:
+		if event.Time.Sub(p.logged) < p.interval {
+			return
+		}
+		p.logged = event.Time
+
+		switch progress.Phase {
+		case phaseScanning:
+			p.log.Infof("Scanning: %d files walked, %d found", progress.Walked, progress.Found)
+		case phaseHashing:
+			rate, left := throughput(progress, event.Time.Sub(p.started))
+			p.log.Infof("Hashing: %d%% (%d of %d files, %s of %s, %s/s, ETA %s)",
+				progress.Percent(), progress.Hashed, progress.Total,
+				report.FormatBytes(progress.HashedBytes), report.FormatBytes(progress.TotalBytes),
+				report.FormatBytes(int64(rate)), left)
+		}
+	}
+}
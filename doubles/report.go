@@ -0,0 +1,54 @@
+package doubles
+
+import (
+	"doubles/report"
+	. "doubles/types"
+	"sort"
+	"time"
+)
+
+func reportMode(options *Options) string {
+	if options.Similar {
+		return "similar"
+	}
+	return "exact"
+}
+
+func groupPaths(group report.Group) Doubles {
+	list := make(Doubles, 0, len(group.Members))
+	for _, m := range group.Members {
+		list = append(list, m.Path)
+	}
+	return list
+}
+
+func (f *Finder) buildReport(doubles map[string]Doubles, started time.Time) *report.Report {
+	res := report.NewReport(f.options, reportMode(f.options), started)
+	res.Totals.Files = f.images.Length()
+	res.Totals.ArchiveEntries = f.images.ArchiveEntries()
+	res.Errors = f.images.Errors()
+
+	ids := make([]string, 0, len(doubles))
+	for id := range doubles {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		return doubles[ids[a]][0] < doubles[ids[b]][0]
+	})
+
+	for _, id := range ids {
+		images := f.images.Images(doubles[id])
+		_, removable := planGroup(images, f.options.Keep, f.options.ArchiveKeeps)
+		remove := make(map[string]bool)
+		for _, filename := range removable {
+			remove[filename] = true
+		}
+
+		members := make([]report.Member, 0, len(doubles[id]))
+		for _, image := range images {
+			members = append(members, report.NewMember(image, !remove[image.Path]))
+		}
+		res.AddGroup(id, members)
+	}
+	return res
+}
@@ -0,0 +1,16 @@
+package doubles
+
+import (
+	"context"
+	"doubles/logger"
+	"doubles/report"
+	. "doubles/types"
+)
+
+func ApplySelection(ctx context.Context, options *Options) {
+	res, err := report.LoadSelection(options.Selection)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	printApplied(Apply(ctx, res.Groups))
+}
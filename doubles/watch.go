@@ -0,0 +1,241 @@
+package doubles
+
+import (
+	"bytes"
+	"context"
+	"doubles/colors"
+	. "doubles/config"
+	"doubles/logger"
+	. "doubles/types"
+	"doubles/utils"
+	"doubles/watch"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+type DuplicateEvent struct {
+	Time       time.Time `json:"time"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash"`
+	MimeType   string    `json:"mime_type"`
+	Duplicates []string  `json:"duplicates"`
+}
+
+func isEventsModeValid(mode string) bool {
+	return mode == EventsLog || mode == EventsJSON || mode == EventsWebhook
+}
+
+func isWebhookValid(webhook string) bool {
+	u, err := url.Parse(webhook)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && utils.IsLoopback(u.Hostname())
+}
+
+func postEvent(webhook string, event DuplicateEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	res, err := client.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("Webhook responded with %s", res.Status)
+	}
+	return nil
+}
+
+func emitEvent(event DuplicateEvent, options *Options) {
+	switch options.Events {
+	case EventsJSON:
+		if err := json.NewEncoder(os.Stdout).Encode(event); err != nil {
+			logger.Error(err)
+		}
+	case EventsWebhook:
+		if err := postEvent(options.Webhook, event); err != nil {
+			logger.Error(err)
+		}
+	default:
+		logger.Infof("%s duplicates %s", colors.Green(event.Path), Doubles(event.Duplicates))
+	}
+}
+
+func addWatches(w *watch.Watcher, dir string, options *Options) error {
+	return filepath.Walk(dir, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if utils.InArray(path.Base(currentPath), options.Skip) {
+			return filepath.SkipDir
+		}
+		return w.Add(currentPath)
+	})
+}
+
+func (f *Finder) watchFile(filename string, emit func(DuplicateEvent)) {
+	info, err := os.Stat(filename)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	mimeType, ok, err := isMedia(file, f.mediaTypes)
+	file.Close()
+	if err != nil || !ok {
+		return
+	}
+
+	f.images.Remove(filename)
+	f.images.AddFile(filename, info, mimeType)
+	if err := f.hashFile(filename); err != nil {
+		f.images.Remove(filename)
+		f.addError(filename, err)
+		return
+	}
+
+	list := f.images.Matches(filename, f.options)
+	if len(list) == 0 {
+		return
+	}
+	image := f.images.Image(filename)
+	emit(DuplicateEvent{
+		Time:       time.Now(),
+		Path:       filename,
+		Size:       image.Size,
+		Hash:       image.Hash,
+		MimeType:   image.MimeType,
+		Duplicates: list,
+	})
+}
+
+func (f *Finder) watchDirectory(w *watch.Watcher, dir string, emit func(DuplicateEvent)) error {
+	if utils.InArray(path.Base(dir), f.options.Skip) {
+		return nil
+	}
+	if err := addWatches(w, dir, f.options); err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && utils.InArray(path.Base(currentPath), f.options.Skip) {
+			return filepath.SkipDir
+		}
+		if image := f.images.Image(currentPath); image != nil && image.Size == info.Size() && image.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			f.watchFile(currentPath, emit)
+		}
+		return nil
+	})
+}
+
+// rescan catches up after the kernel dropped events: files that are gone are
+// removed and new or changed ones are checked as if they had just been written.
+func (f *Finder) rescan(w *watch.Watcher, emit func(DuplicateEvent)) error {
+	for filename, state := range f.images.States() {
+		if len(state.Image.Archive) > 0 {
+			continue
+		}
+		if _, err := os.Lstat(filename); os.IsNotExist(err) {
+			f.images.Remove(filename)
+		}
+	}
+	return f.watchDirectory(w, f.options.Directory, emit)
+}
+
+func (f *Finder) Watch(ctx context.Context, emit func(DuplicateEvent)) error {
+	w, err := watch.New()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := Validate(f.options); err != nil {
+		return err
+	}
+	if err := addWatches(w, f.options.Directory, f.options); err != nil {
+		return err
+	}
+
+	if _, err := f.FindContext(ctx); err != nil {
+		return err
+	}
+	if f.options.Similar {
+		f.images.IndexFingerprints()
+	}
+	f.Log.Infof("Watching %s for new doubles", f.options.Directory)
+
+	errs := w.Errors
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			switch event.Op {
+			case watch.Write:
+				f.watchFile(event.Path, emit)
+			case watch.Remove:
+				f.images.Remove(event.Path)
+			case watch.Directory:
+				if err := f.watchDirectory(w, event.Path, emit); err != nil {
+					f.addError(event.Path, err)
+				}
+			case watch.RemoveDirectory:
+				f.images.RemoveUnder(event.Path)
+			case watch.Overflow:
+				f.Log.Warnf("Too many changes at once, rescanning %s", f.options.Directory)
+				if err := f.rescan(w, emit); err != nil {
+					f.addError(f.options.Directory, err)
+				}
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			return err
+		}
+	}
+}
+
+func Watch(ctx context.Context, options *Options, config *Config) {
+	if !isEventsModeValid(options.Events) {
+		logger.Fatal("Invalid events mode")
+	}
+	if options.Events == EventsWebhook && !isWebhookValid(options.Webhook) {
+		logger.Fatal("Invalid webhook URL, it must point to this machine")
+	}
+
+	finder := NewFinder(options, config)
+	finder.Log = logger.Default()
+	if progress := newProgress(options); progress != nil {
+		finder.Subscribe(progress)
+	}
+	err := finder.Watch(ctx, func(event DuplicateEvent) { emitEvent(event, options) })
+	if err != nil && err != ctx.Err() {
+		logger.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+package ffmpeg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+var errNoVideoStream = errors.New("No video stream found")
+
+type Info struct {
+	Duration float64
+	Width    int
+	Height   int
+}
+
+type probeResult struct {
+	Streams []struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+func Available() bool {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func Probe(filename string) (*Info, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height:format=duration", "-of", "json", filename).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var res probeResult
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Streams) == 0 {
+		return nil, errNoVideoStream
+	}
+
+	info := &Info{Width: res.Streams[0].Width, Height: res.Streams[0].Height}
+	info.Duration, _ = strconv.ParseFloat(res.Format.Duration, 64)
+	return info, nil
+}
+
+func GrayFrames(filename string, interval float64, size int) ([][]byte, error) {
+	filter := fmt.Sprintf("fps=1/%g,scale=%d:%d", interval, size, size)
+	out, err := exec.Command("ffmpeg", "-v", "error", "-i", filename,
+		"-vf", filter, "-f", "rawvideo", "-pix_fmt", "gray", "-").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	frameSize := size * size
+	frames := make([][]byte, 0, len(out)/frameSize)
+	for len(out) >= frameSize {
+		frames = append(frames, out[:frameSize])
+		out = out[frameSize:]
+	}
+	return frames, nil
+}
+
+func PCM(filename string, rate int) ([]int16, error) {
+	out, err := exec.Command("ffmpeg", "-v", "error", "-i", filename, "-vn",
+		"-ac", "1", "-ar", strconv.Itoa(rate), "-f", "s16le", "-").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]int16, len(out)/2)
+	for k := range samples {
+		samples[k] = int16(binary.LittleEndian.Uint16(out[k*2:]))
+	}
+	return samples, nil
+}
@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"doubles/colors"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var ErrInvalidFormat = errors.New("Invalid log format")
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+type Logger struct {
+	mux    sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+	au     aurora.Aurora
+	plain  bool
+}
+
+type entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+func New(out io.Writer) *Logger {
+	return &Logger{out: out, level: LevelInfo, format: FormatText, au: aurora.NewAurora(false), plain: true}
+}
+
+func (l *Logger) Configure(level Level, format string) error {
+	if format != FormatText && format != FormatJSON {
+		return ErrInvalidFormat
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.level = level
+	l.format = format
+	return nil
+}
+
+func (l *Logger) SetColors(enabled bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.au = aurora.NewAurora(enabled)
+	l.plain = !enabled
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return level >= l.level
+}
+
+func (l *Logger) label(level Level) interface{} {
+	switch level {
+	case LevelDebug:
+		return l.au.Gray("DEBUG")
+	case LevelWarn:
+		return l.au.Brown("WARN")
+	case LevelError:
+		return l.au.Red("ERROR")
+	}
+	return l.au.Green("INFO")
+}
+
+func (l *Logger) log(level Level, message string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if level < l.level {
+		return
+	}
+
+	now := time.Now()
+	if l.plain || l.format == FormatJSON {
+		message = colors.Strip(message)
+	}
+	if l.format == FormatJSON {
+		json.NewEncoder(l.out).Encode(entry{Time: now, Level: levelNames[level], Message: message})
+		return
+	}
+	fmt.Fprintf(l.out, "%s %s %s\n", now.Format("2006/01/02 15:04:05"), l.label(level), message)
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.log(LevelDebug, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.log(LevelInfo, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.log(LevelWarn, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.log(LevelError, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Error(v ...interface{}) {
+	l.log(LevelError, fmt.Sprint(v...))
+}
+
+func (l *Logger) Fatal(v ...interface{}) {
+	l.log(LevelError, fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+var std = New(os.Stderr)
+
+func Default() *Logger {
+	return std
+}
+
+func Configure(level Level, format string) error {
+	return std.Configure(level, format)
+}
+
+func SetColors(enabled bool) {
+	std.SetColors(enabled)
+}
+
+func Enabled(level Level) bool {
+	return std.Enabled(level)
+}
+
+func Debugf(format string, v ...interface{}) {
+	std.Debugf(format, v...)
+}
+
+func Infof(format string, v ...interface{}) {
+	std.Infof(format, v...)
+}
+
+func Warnf(format string, v ...interface{}) {
+	std.Warnf(format, v...)
+}
+
+func Errorf(format string, v ...interface{}) {
+	std.Errorf(format, v...)
+}
+
+func Error(v ...interface{}) {
+	std.Error(v...)
+}
+
+func Fatal(v ...interface{}) {
+	std.Fatal(v...)
+}
@@ -1,37 +1,84 @@
 package main
 
 import (
+	"context"
+	"doubles/colors"
 	. "doubles/config"
 	"doubles/doubles"
+	"doubles/logger"
+	"doubles/server"
+	. "doubles/types"
 	"doubles/utils"
-	"fmt"
-	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
-
-	colors "github.com/logrusorgru/aurora"
 )
 
-const pathToConfig string = "./config/config.json"
-
 var conf *Config
 
-func init() {
-	conf = NewConfig()
-	if err := conf.Load(NewJsonLoader(pathToConfig)); err != nil {
-		log.Fatal(colors.Red(err))
+func setupLogging(options *Options) error {
+	level := logger.LevelInfo
+	if options.Quiet {
+		level = logger.LevelWarn
+	} else if options.Verbose {
+		level = logger.LevelDebug
+	}
+	noColor := len(os.Getenv("NO_COLOR")) > 0
+	colors.Enable(options.LogFormat == logger.FormatText && !noColor && colors.IsTerminal(os.Stdout))
+	logger.SetColors(options.LogFormat == logger.FormatText && !noColor && colors.IsTerminal(os.Stderr))
+	return logger.Configure(level, options.LogFormat)
+}
+
+func serve(ctx context.Context, options *Options) {
+	handler := server.New(ctx, conf)
+	handler.AllowRemote = options.AllowRemote
+	srv := &http.Server{Addr: options.Listen, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	logger.Infof("Listening on %s", options.Listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Fatal(err)
 	}
 }
 
 func main() {
 	options, err := utils.GetCliOptions()
 	if err != nil {
-		log.Fatal(colors.Red(err))
+		logger.Fatal(err)
+	}
+	if err := setupLogging(options); err != nil {
+		logger.Fatal(err)
+	}
+	conf = NewConfig()
+	if err := conf.Load(SearchPath(options.Config, options.Settings)...); err != nil {
+		logger.Fatal(err)
 	}
 
 	start := time.Now()
 
-	doubles.Run(options, conf)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if len(options.Apply) > 0 {
+		doubles.ApplyReport(ctx, options)
+	} else if len(options.Selection) > 0 {
+		doubles.ApplySelection(ctx, options)
+	} else if options.Serve {
+		serve(ctx, options)
+	} else if options.Watch {
+		doubles.Watch(ctx, options, conf)
+	} else {
+		doubles.Run(ctx, options, conf)
+	}
 
-	duration := time.Since(start)
-	fmt.Printf("\nDone in: %s\n", colors.Green(duration))
+	logger.Infof("Done in: %s", colors.Green(time.Since(start)))
 }
@@ -0,0 +1,243 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const maxMetaBoxSize = 16 << 20
+
+var errInvalidHEIC = errors.New("Invalid HEIC container")
+
+type box struct {
+	kind string
+	data []byte
+}
+
+type extent struct {
+	offset uint64
+	length uint64
+}
+
+func readBoxes(data []byte) []box {
+	var boxes []box
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		kind := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, box{kind: kind, data: data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+func findBox(boxes []box, kind string) []byte {
+	for _, b := range boxes {
+		if b.kind == kind {
+			return b.data
+		}
+	}
+	return nil
+}
+
+func readUint(data []byte, size int) (uint64, []byte) {
+	if len(data) < size {
+		return 0, nil
+	}
+	switch size {
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case 8:
+		return binary.BigEndian.Uint64(data), data[8:]
+	}
+	return 0, data[size:]
+}
+
+func findMetaBox(r io.ReaderAt) ([]byte, error) {
+	var offset int64
+	header := make([]byte, 16)
+	for {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		if size == 1 {
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize {
+			return nil, errInvalidHEIC
+		}
+		if string(header[4:8]) == "meta" {
+			if size > maxMetaBoxSize {
+				return nil, errInvalidHEIC
+			}
+			data := make([]byte, size-headerSize)
+			if _, err := r.ReadAt(data, offset+headerSize); err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+		offset += size
+	}
+}
+
+func parseItemTypes(data []byte) map[uint64]string {
+	types := make(map[uint64]string)
+	if len(data) < 4 {
+		return types
+	}
+	countSize := 2
+	if data[0] > 0 {
+		countSize = 4
+	}
+	if _, data = readUint(data[4:], countSize); data == nil {
+		return types
+	}
+
+	for _, b := range readBoxes(data) {
+		if b.kind != "infe" || len(b.data) < 4 || b.data[0] < 2 {
+			continue
+		}
+		idSize := 2
+		if b.data[0] > 2 {
+			idSize = 4
+		}
+		id, rest := readUint(b.data[4:], idSize)
+		if len(rest) < 6 {
+			continue
+		}
+		types[id] = string(rest[2:6])
+	}
+	return types
+}
+
+func parseItemLocations(data []byte) map[uint64][]extent {
+	locations := make(map[uint64][]extent)
+	if len(data) < 8 {
+		return locations
+	}
+	version := data[0]
+	offsetSize := int(data[4] >> 4)
+	lengthSize := int(data[4] & 0x0f)
+	baseOffsetSize := int(data[5] >> 4)
+	indexSize := 0
+	if version > 0 {
+		indexSize = int(data[5] & 0x0f)
+	}
+
+	idSize := 2
+	if version > 1 {
+		idSize = 4
+	}
+	count, data := readUint(data[6:], idSize)
+
+	for i := uint64(0); i < count && data != nil; i++ {
+		var id, base, extents uint64
+		if id, data = readUint(data, idSize); data == nil {
+			break
+		}
+		if version > 0 {
+			if _, data = readUint(data, 2); data == nil {
+				break
+			}
+		}
+		if _, data = readUint(data, 2); data == nil {
+			break
+		}
+		if base, data = readUint(data, baseOffsetSize); data == nil {
+			break
+		}
+		if extents, data = readUint(data, 2); data == nil {
+			break
+		}
+		for j := uint64(0); j < extents && data != nil; j++ {
+			var e extent
+			if indexSize > 0 {
+				_, data = readUint(data, indexSize)
+			}
+			e.offset, data = readUint(data, offsetSize)
+			e.length, data = readUint(data, lengthSize)
+			e.offset += base
+			locations[id] = append(locations[id], e)
+		}
+	}
+	return locations
+}
+
+func parseImageSize(data []byte, m *Metadata) {
+	for _, b := range readBoxes(findBox(readBoxes(data), "ipco")) {
+		if b.kind != "ispe" || len(b.data) < 12 {
+			continue
+		}
+		width := int(binary.BigEndian.Uint32(b.data[4:8]))
+		height := int(binary.BigEndian.Uint32(b.data[8:12]))
+		if width*height > m.Width*m.Height {
+			m.Width, m.Height = width, height
+		}
+	}
+}
+
+func readHEIC(r io.ReaderAt, m *Metadata) error {
+	meta, err := findMetaBox(r)
+	if err != nil {
+		return err
+	}
+	if len(meta) < 4 {
+		return errInvalidHEIC
+	}
+	boxes := readBoxes(meta[4:])
+
+	parseImageSize(findBox(boxes, "iprp"), m)
+
+	types := parseItemTypes(findBox(boxes, "iinf"))
+	locations := parseItemLocations(findBox(boxes, "iloc"))
+
+	for id, kind := range types {
+		if kind != "Exif" || len(locations[id]) == 0 {
+			continue
+		}
+		e := locations[id][0]
+		if e.length < 4 || e.length > maxMetaBoxSize {
+			continue
+		}
+		data := make([]byte, e.length)
+		if _, err := r.ReadAt(data, int64(e.offset)); err != nil {
+			return err
+		}
+		start := 4 + uint64(binary.BigEndian.Uint32(data[0:4]))
+		if start >= e.length {
+			continue
+		}
+
+		width, height := m.Width, m.Height
+		if err := parseTIFF(bytes.NewReader(data[start:]), m); err != nil {
+			return err
+		}
+		if width > 0 {
+			m.Width, m.Height = width, height
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	exifHeader      = []byte("Exif\x00\x00")
+	xmpHeader       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	photoshopHeader = []byte("Photoshop 3.0\x00")
+)
+
+var errInvalidJPEG = errors.New("Invalid JPEG header")
+
+func isSOF(marker byte) bool {
+	return marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc
+}
+
+func readJPEG(r io.Reader, m *Metadata) error {
+	reader := bufio.NewReader(r)
+
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(reader, soi); err != nil {
+		return err
+	}
+	if soi[0] != 0xff || soi[1] != 0xd8 {
+		return errInvalidJPEG
+	}
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != 0xff {
+			continue
+		}
+
+		marker, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if marker == 0xff || marker == 0x00 || (marker >= 0xd0 && marker <= 0xd7) {
+			continue
+		}
+		if marker == 0xd9 || marker == 0xda {
+			return nil
+		}
+
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(header)) - 2
+		if length < 0 {
+			return errInvalidJPEG
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(reader, segment); err != nil {
+			return err
+		}
+
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(segment, exifHeader):
+			if err := parseTIFF(bytes.NewReader(segment[len(exifHeader):]), m); err != nil {
+				return err
+			}
+		case marker == 0xe1 && bytes.HasPrefix(segment, xmpHeader):
+			parseXMP(segment[len(xmpHeader):], m)
+		case marker == 0xed && bytes.HasPrefix(segment, photoshopHeader):
+			parseIPTC(segment[len(photoshopHeader):], m)
+		case isSOF(marker) && len(segment) >= 5:
+			m.Height = int(binary.BigEndian.Uint16(segment[1:3]))
+			m.Width = int(binary.BigEndian.Uint16(segment[3:5]))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package metadata
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"io"
+	"strings"
+	"time"
+)
+
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+type Metadata struct {
+	Make        string     `json:"make,omitempty"`
+	Model       string     `json:"model,omitempty"`
+	Taken       *time.Time `json:"taken,omitempty"`
+	Width       int        `json:"width,omitempty"`
+	Height      int        `json:"height,omitempty"`
+	Orientation int        `json:"orientation,omitempty"`
+	Duration    float64    `json:"duration,omitempty"`
+	Software    string     `json:"software,omitempty"`
+	Artist      string     `json:"artist,omitempty"`
+	Copyright   string     `json:"copyright,omitempty"`
+	Sources     []string   `json:"sources,omitempty"`
+}
+
+func (m *Metadata) Camera() string {
+	if len(m.Model) == 0 {
+		return m.Make
+	}
+	if len(m.Make) == 0 || strings.HasPrefix(m.Model, m.Make) {
+		return m.Model
+	}
+	return m.Make + " " + m.Model
+}
+
+func (m *Metadata) Completeness() int {
+	num := 0
+	for _, v := range []string{m.Make, m.Model, m.Software, m.Artist, m.Copyright} {
+		if len(v) > 0 {
+			num++
+		}
+	}
+	for _, v := range []int{m.Width, m.Height, m.Orientation} {
+		if v > 0 {
+			num++
+		}
+	}
+	if m.Taken != nil {
+		num++
+	}
+	return num
+}
+
+func (m *Metadata) String() string {
+	var parts []string
+	if camera := m.Camera(); len(camera) > 0 {
+		parts = append(parts, camera)
+	}
+	if m.Taken != nil {
+		parts = append(parts, m.Taken.Format("2006-01-02 15:04:05"))
+	}
+	if m.Width > 0 && m.Height > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", m.Width, m.Height))
+	}
+	if m.Orientation > 0 {
+		parts = append(parts, fmt.Sprintf("orientation %d", m.Orientation))
+	}
+	if m.Duration > 0 {
+		parts = append(parts, (time.Duration(m.Duration * float64(time.Second))).Round(time.Second).String())
+	}
+	if len(parts) == 0 {
+		return "no metadata"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (m *Metadata) setTaken(taken time.Time) {
+	if !taken.IsZero() {
+		m.Taken = &taken
+	}
+}
+
+func (m *Metadata) addSource(source string) {
+	for _, v := range m.Sources {
+		if v == source {
+			return
+		}
+	}
+	m.Sources = append(m.Sources, source)
+}
+
+func Read(file File, mimeType string) (*Metadata, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{}
+	var err error
+
+	switch mimeType {
+	case "image/jpeg":
+		err = readJPEG(file, m)
+	case "image/tiff":
+		err = parseTIFF(file, m)
+	case "image/heic", "image/heif":
+		err = readHEIC(file, m)
+	default:
+		var conf image.Config
+		if conf, _, err = image.DecodeConfig(file); err == nil {
+			m.Width, m.Height = conf.Width, conf.Height
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,196 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	tagImageWidth       = 0x0100
+	tagImageLength      = 0x0101
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagArtist           = 0x013b
+	tagXMP              = 0x02bc
+	tagCopyright        = 0x8298
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+	tagPixelXDimension  = 0xa002
+	tagPixelYDimension  = 0xa003
+)
+
+const (
+	maxIFDEntries = 1024
+	maxTagLength  = 1 << 20
+)
+
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8}
+
+var errInvalidTIFF = errors.New("Invalid TIFF header")
+
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func (t *tiffReader) readAt(offset int64, size uint32) ([]byte, error) {
+	if size > maxTagLength {
+		return nil, errInvalidTIFF
+	}
+	buffer := make([]byte, size)
+	if _, err := t.r.ReadAt(buffer, offset); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+func (t *tiffReader) readIFD(offset int64) ([]tiffEntry, error) {
+	header, err := t.readAt(offset, 2)
+	if err != nil {
+		return nil, err
+	}
+	num := t.order.Uint16(header)
+	if num > maxIFDEntries {
+		return nil, errInvalidTIFF
+	}
+
+	raw, err := t.readAt(offset+2, uint32(num)*12)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]tiffEntry, 0, num)
+	for i := 0; i < int(num); i++ {
+		e := raw[i*12 : (i+1)*12]
+		entry := tiffEntry{
+			tag:   t.order.Uint16(e[0:2]),
+			typ:   t.order.Uint16(e[2:4]),
+			count: t.order.Uint32(e[4:8]),
+		}
+		size, ok := typeSizes[entry.typ]
+		if !ok || entry.count > maxTagLength {
+			continue
+		}
+		length := size * entry.count
+		if length <= 4 {
+			entry.data = e[8 : 8+length]
+		} else if entry.data, err = t.readAt(int64(t.order.Uint32(e[8:12])), length); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) uint(e tiffEntry) int {
+	switch {
+	case e.typ == 3 && len(e.data) >= 2:
+		return int(t.order.Uint16(e.data))
+	case e.typ == 4 && len(e.data) >= 4:
+		return int(t.order.Uint32(e.data))
+	case e.typ == 1 && len(e.data) >= 1:
+		return int(e.data[0])
+	}
+	return 0
+}
+
+func (t *tiffReader) string(e tiffEntry) string {
+	return strings.TrimSpace(strings.TrimRight(string(e.data), "\x00"))
+}
+
+func parseExifTime(value string) time.Time {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	taken, err := time.Parse("2006:01:02 15:04:05", value)
+	if err != nil {
+		return time.Time{}
+	}
+	return taken
+}
+
+func parseTIFF(r io.ReaderAt, m *Metadata) error {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return err
+	}
+
+	t := &tiffReader{r: r}
+	switch string(header[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return errInvalidTIFF
+	}
+
+	entries, err := t.readIFD(int64(t.order.Uint32(header[4:8])))
+	if err != nil {
+		return err
+	}
+	m.addSource("exif")
+
+	var modified time.Time
+	for _, e := range entries {
+		switch e.tag {
+		case tagMake:
+			m.Make = t.string(e)
+		case tagModel:
+			m.Model = t.string(e)
+		case tagSoftware:
+			m.Software = t.string(e)
+		case tagArtist:
+			m.Artist = t.string(e)
+		case tagCopyright:
+			m.Copyright = t.string(e)
+		case tagOrientation:
+			m.Orientation = t.uint(e)
+		case tagImageWidth:
+			m.Width = t.uint(e)
+		case tagImageLength:
+			m.Height = t.uint(e)
+		case tagDateTime:
+			modified = parseExifTime(string(e.data))
+		case tagXMP:
+			parseXMP(e.data, m)
+		case tagExifIFD:
+			if sub, err := t.readIFD(int64(t.uint(e))); err == nil {
+				t.parseExifIFD(sub, m)
+			}
+		}
+	}
+
+	if m.Taken == nil {
+		m.setTaken(modified)
+	}
+	return nil
+}
+
+func (t *tiffReader) parseExifIFD(entries []tiffEntry, m *Metadata) {
+	for _, e := range entries {
+		switch e.tag {
+		case tagDateTimeOriginal:
+			m.setTaken(parseExifTime(string(e.data)))
+		case tagPixelXDimension:
+			if width := t.uint(e); width > 0 {
+				m.Width = width
+			}
+		case tagPixelYDimension:
+			if height := t.uint(e); height > 0 {
+				m.Height = height
+			}
+		}
+	}
+}
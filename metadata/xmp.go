@@ -0,0 +1,153 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var xmpDateFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+var xmpTakenFields = []string{"exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate"}
+
+var xmpFields = map[string]*regexp.Regexp{}
+
+func init() {
+	names := append([]string{
+		"tiff:Make", "tiff:Model", "xmp:CreatorTool", "tiff:Orientation",
+		"exif:PixelXDimension", "exif:PixelYDimension",
+	}, xmpTakenFields...)
+	for _, name := range names {
+		quoted := regexp.QuoteMeta(name)
+		xmpFields[name] = regexp.MustCompile(quoted + `="([^"]*)"|<` + quoted + `>([^<]*)</` + quoted + `>`)
+	}
+}
+
+func xmpValue(data []byte, name string) string {
+	match := xmpFields[name].FindSubmatch(data)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(string(match[1]) + string(match[2]))
+}
+
+func parseXMPTime(value string) time.Time {
+	for _, layout := range xmpDateFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func setString(target *string, value string) {
+	if len(*target) == 0 {
+		*target = value
+	}
+}
+
+func setInt(target *int, value string) {
+	if *target == 0 {
+		*target, _ = strconv.Atoi(value)
+	}
+}
+
+func parseXMP(data []byte, m *Metadata) {
+	if !bytes.Contains(data, []byte("xmpmeta")) {
+		return
+	}
+	m.addSource("xmp")
+
+	setString(&m.Make, xmpValue(data, "tiff:Make"))
+	setString(&m.Model, xmpValue(data, "tiff:Model"))
+	setString(&m.Software, xmpValue(data, "xmp:CreatorTool"))
+	setInt(&m.Orientation, xmpValue(data, "tiff:Orientation"))
+	setInt(&m.Width, xmpValue(data, "exif:PixelXDimension"))
+	setInt(&m.Height, xmpValue(data, "exif:PixelYDimension"))
+
+	if m.Taken == nil {
+		for _, name := range xmpTakenFields {
+			if m.setTaken(parseXMPTime(xmpValue(data, name))); m.Taken != nil {
+				break
+			}
+		}
+	}
+}
+
+const iptcResource = 0x0404
+
+func parseIPTC(data []byte, m *Metadata) {
+	for len(data) >= 12 && bytes.HasPrefix(data, []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(data[4:6])
+		nameLength := int(data[6]) + 1
+		if nameLength%2 != 0 {
+			nameLength++
+		}
+		offset := 6 + nameLength
+		if len(data) < offset+4 {
+			return
+		}
+		size := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		offset += 4
+		if size < 0 || len(data) < offset+size {
+			return
+		}
+		if id == iptcResource {
+			parseIPTCRecords(data[offset:offset+size], m)
+		}
+		if size%2 != 0 {
+			size++
+		}
+		if len(data) < offset+size {
+			return
+		}
+		data = data[offset+size:]
+	}
+}
+
+func parseIPTCRecords(data []byte, m *Metadata) {
+	var date, clock string
+	for len(data) >= 5 && data[0] == 0x1c {
+		record, dataset := data[1], data[2]
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+size {
+			break
+		}
+		value := strings.TrimSpace(string(data[5 : 5+size]))
+		data = data[5+size:]
+
+		if record != 2 {
+			continue
+		}
+		m.addSource("iptc")
+
+		switch dataset {
+		case 55:
+			date = value
+		case 60:
+			clock = value
+		case 80:
+			setString(&m.Artist, value)
+		case 116:
+			setString(&m.Copyright, value)
+		}
+	}
+
+	if m.Taken == nil && len(date) == 8 {
+		if len(clock) >= 6 {
+			taken, _ := time.Parse("20060102150405", date+clock[:6])
+			m.setTaken(taken)
+		} else {
+			taken, _ := time.Parse("20060102", date)
+			m.setTaken(taken)
+		}
+	}
+}
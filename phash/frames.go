@@ -0,0 +1,43 @@
+package phash
+
+import "image"
+
+func FrameHashes(frames []image.Image) []Hash {
+	hashes := make([]Hash, 0, len(frames))
+	for _, frame := range frames {
+		hashes = append(hashes, NewGrid(frame).Hash())
+	}
+	return hashes
+}
+
+// Uniform reports whether a frame hash carries no picture, as for a blank or
+// single-colour frame.
+func (h Hash) Uniform() bool {
+	return h == 0 || h == ^Hash(0)
+}
+
+// Distinct counts the different frame hashes that are not uniform.
+func Distinct(hashes []Hash) int {
+	seen := make(map[Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		if !hash.Uniform() {
+			seen[hash] = true
+		}
+	}
+	return len(seen)
+}
+
+func FrameDistance(a, b []Hash) int {
+	if len(a) == 0 || len(b) == 0 {
+		return MaxDistance
+	}
+	num := len(a)
+	if len(b) > num {
+		num = len(b)
+	}
+	total := 0
+	for k := 0; k < num; k++ {
+		total += Distance(a[k*len(a)/num], b[k*len(b)/num])
+	}
+	return (total + num - 1) / num
+}
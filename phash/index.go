@@ -0,0 +1,76 @@
+package phash
+
+const (
+	indexChunks    = 4
+	indexChunkBits = 64 / indexChunks
+)
+
+type Index struct {
+	hashes  []Hash
+	ids     []int
+	buckets [indexChunks][][]int
+}
+
+func chunk(hash Hash, k int) uint16 {
+	return uint16(hash >> uint(k*indexChunkBits))
+}
+
+func (x *Index) Len() int {
+	return len(x.hashes)
+}
+
+func (x *Index) Add(hash Hash, id int) {
+	pos := len(x.hashes)
+	x.hashes = append(x.hashes, hash)
+	x.ids = append(x.ids, id)
+	for k := 0; k < indexChunks; k++ {
+		key := chunk(hash, k)
+		x.buckets[k][key] = append(x.buckets[k][key], pos)
+	}
+}
+
+func neighbours(key uint16, distance int, from uint, fn func(key uint16)) {
+	fn(key)
+	if distance == 0 {
+		return
+	}
+	for bit := from; bit < indexChunkBits; bit++ {
+		neighbours(key^(1<<bit), distance-1, bit+1, fn)
+	}
+}
+
+// Query calls fn for every indexed hash within threshold of hash. Hashes are
+// split into chunks, so any match shares at least one chunk that differs by
+// no more than threshold/indexChunks bits. A match is reported only from the
+// first such chunk, which avoids tracking what was already seen.
+func (x *Index) Query(hash Hash, threshold int, fn func(id, distance int)) {
+	limit := threshold / indexChunks
+	for k := 0; k < indexChunks; k++ {
+		neighbours(chunk(hash, k), limit, 0, func(key uint16) {
+			for _, pos := range x.buckets[k][key] {
+				d := Distance(x.hashes[pos], hash)
+				if d > threshold || x.foundEarlier(pos, hash, k, limit) {
+					continue
+				}
+				fn(x.ids[pos], d)
+			}
+		})
+	}
+}
+
+func (x *Index) foundEarlier(pos int, hash Hash, k, limit int) bool {
+	for j := 0; j < k; j++ {
+		if Distance(Hash(chunk(x.hashes[pos], j)), Hash(chunk(hash, j))) <= limit {
+			return true
+		}
+	}
+	return false
+}
+
+func NewIndex() *Index {
+	x := &Index{}
+	for k := range x.buckets {
+		x.buckets[k] = make([][]int, 1<<indexChunkBits)
+	}
+	return x
+}
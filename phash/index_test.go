@@ -0,0 +1,119 @@
+package phash
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomHashes(r *rand.Rand, num int) []Hash {
+	hashes := make([]Hash, num)
+	for k := range hashes {
+		hashes[k] = Hash(r.Uint64())
+	}
+	return hashes
+}
+
+func flipBits(r *rand.Rand, hash Hash, bits int) Hash {
+	for _, bit := range r.Perm(64)[:bits] {
+		hash ^= 1 << uint(bit)
+	}
+	return hash
+}
+
+type match struct {
+	id       int
+	distance int
+}
+
+func linearScan(hashes []Hash, hash Hash, threshold int) []match {
+	var matches []match
+	for id, h := range hashes {
+		if d := Distance(h, hash); d <= threshold {
+			matches = append(matches, match{id, d})
+		}
+	}
+	return matches
+}
+
+func queryIndex(x *Index, hash Hash, threshold int) []match {
+	var matches []match
+	x.Query(hash, threshold, func(id, distance int) {
+		matches = append(matches, match{id, distance})
+	})
+	sort.Slice(matches, func(a, b int) bool { return matches[a].id < matches[b].id })
+	return matches
+}
+
+func TestIndexQueryMatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	hashes := randomHashes(r, 500)
+	for k := 0; k < 500; k++ {
+		hashes = append(hashes, flipBits(r, hashes[r.Intn(len(hashes))], r.Intn(20)))
+	}
+	x := NewIndex()
+	for id, hash := range hashes {
+		x.Add(hash, id)
+	}
+
+	queries := randomHashes(r, 20)
+	for k := 0; k < 20; k++ {
+		queries = append(queries, flipBits(r, hashes[r.Intn(len(hashes))], k))
+	}
+
+	for _, threshold := range []int{0, 1, 15, 16, 63} {
+		t.Run(fmt.Sprintf("threshold=%d", threshold), func(t *testing.T) {
+			for _, query := range queries {
+				want := linearScan(hashes, query, threshold)
+				got := queryIndex(x, query, threshold)
+				if len(got) != len(want) {
+					t.Fatalf("query %s: got %d matches, want %d", query, len(got), len(want))
+				}
+				for k := range want {
+					if got[k] != want[k] {
+						t.Fatalf("query %s: got %v, want %v", query, got[k], want[k])
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkIndexQuery(b *testing.B) {
+	for _, num := range []int{10000, 100000} {
+		r := rand.New(rand.NewSource(1))
+		hashes := randomHashes(r, num)
+		x := NewIndex()
+		for id, hash := range hashes {
+			x.Add(hash, id)
+		}
+		queries := make([]Hash, 1000)
+		for k := range queries {
+			queries[k] = flipBits(r, hashes[r.Intn(num)], r.Intn(10))
+		}
+
+		b.Run(fmt.Sprintf("hashes=%d", num), func(b *testing.B) {
+			for k := 0; k < b.N; k++ {
+				x.Query(queries[k%len(queries)], 10, func(id, distance int) {})
+			}
+		})
+	}
+}
+
+func BenchmarkLinearScan(b *testing.B) {
+	for _, num := range []int{10000, 100000} {
+		r := rand.New(rand.NewSource(1))
+		hashes := randomHashes(r, num)
+		queries := make([]Hash, 1000)
+		for k := range queries {
+			queries[k] = flipBits(r, hashes[r.Intn(num)], r.Intn(10))
+		}
+
+		b.Run(fmt.Sprintf("hashes=%d", num), func(b *testing.B) {
+			for k := 0; k < b.N; k++ {
+				linearScan(hashes, queries[k%len(queries)], 10)
+			}
+		})
+	}
+}
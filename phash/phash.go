@@ -0,0 +1,193 @@
+package phash
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	GridSize    = 32
+	hashSize    = 8
+	MaxDistance = hashSize * hashSize
+)
+
+type Hash uint64
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+type Grid [GridSize][GridSize]float64
+
+func luminance(img image.Image, x, y int) float64 {
+	switch src := img.(type) {
+	case *image.YCbCr:
+		return float64(src.Y[src.YOffset(x, y)])
+	case *image.Gray:
+		return float64(src.Pix[src.PixOffset(x, y)])
+	}
+	return float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+}
+
+func NewGrid(img image.Image) *Grid {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	grid := &Grid{}
+	if width == 0 || height == 0 {
+		return grid
+	}
+
+	for gy := 0; gy < GridSize; gy++ {
+		y0 := bounds.Min.Y + gy*height/GridSize
+		y1 := bounds.Min.Y + (gy+1)*height/GridSize
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for gx := 0; gx < GridSize; gx++ {
+			x0 := bounds.Min.X + gx*width/GridSize
+			x1 := bounds.Min.X + (gx+1)*width/GridSize
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			sum := 0.0
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += luminance(img, x, y)
+				}
+			}
+			grid[gy][gx] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+	return grid
+}
+
+func NewGridFromGray(pix []byte) *Grid {
+	grid := &Grid{}
+	for y := 0; y < GridSize && (y+1)*GridSize <= len(pix); y++ {
+		for x := 0; x < GridSize; x++ {
+			grid[y][x] = float64(pix[y*GridSize+x])
+		}
+	}
+	return grid
+}
+
+func (g *Grid) Transform(t Transform) *Grid {
+	res := &Grid{}
+	for y := 0; y < GridSize; y++ {
+		for x := 0; x < GridSize; x++ {
+			sx, sy := t.source(x, y, GridSize)
+			res[y][x] = g[sy][sx]
+		}
+	}
+	return res
+}
+
+var dctTable = func() [hashSize][GridSize]float64 {
+	var table [hashSize][GridSize]float64
+	for u := 0; u < hashSize; u++ {
+		for x := 0; x < GridSize; x++ {
+			table[u][x] = math.Cos(float64((2*x+1)*u) * math.Pi / (2 * GridSize))
+		}
+	}
+	return table
+}()
+
+func (g *Grid) Hash() Hash {
+	var rows [GridSize][hashSize]float64
+	for y := 0; y < GridSize; y++ {
+		for u := 0; u < hashSize; u++ {
+			for x := 0; x < GridSize; x++ {
+				rows[y][u] += g[y][x] * dctTable[u][x]
+			}
+		}
+	}
+
+	coeffs := make([]float64, 0, hashSize*hashSize)
+	for v := 0; v < hashSize; v++ {
+		for u := 0; u < hashSize; u++ {
+			sum := 0.0
+			for y := 0; y < GridSize; y++ {
+				sum += rows[y][u] * dctTable[v][y]
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+
+	sorted := append([]float64{}, coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash Hash
+	for k, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(k)
+		}
+	}
+	return hash
+}
+
+func (g *Grid) Variants() [TransformCount]Hash {
+	var hashes [TransformCount]Hash
+	for t := Transform(0); t < TransformCount; t++ {
+		hashes[t] = g.Transform(t).Hash()
+	}
+	return hashes
+}
+
+type Fingerprint struct {
+	Variants [TransformCount]Hash
+	Crops    []Hash
+	Animated bool
+	Frames   []Hash
+}
+
+func (f *Fingerprint) Hash() Hash {
+	return f.Variants[Identity]
+}
+
+var cropMargins = []float64{0.05, 0.1}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+func cropRects(bounds image.Rectangle) []image.Rectangle {
+	var rects []image.Rectangle
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	for _, margin := range cropMargins {
+		dx, dy := int(width*margin), int(height*margin)
+		rects = append(rects,
+			image.Rect(bounds.Min.X+dx, bounds.Min.Y+dy, bounds.Max.X-dx, bounds.Max.Y-dy),
+			image.Rect(bounds.Min.X+dx, bounds.Min.Y, bounds.Max.X-dx, bounds.Max.Y),
+			image.Rect(bounds.Min.X, bounds.Min.Y+dy, bounds.Max.X, bounds.Max.Y-dy),
+			image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X-2*dx, bounds.Max.Y-2*dy),
+			image.Rect(bounds.Min.X+2*dx, bounds.Min.Y, bounds.Max.X, bounds.Max.Y-2*dy),
+			image.Rect(bounds.Min.X, bounds.Min.Y+2*dy, bounds.Max.X-2*dx, bounds.Max.Y),
+			image.Rect(bounds.Min.X+2*dx, bounds.Min.Y+2*dy, bounds.Max.X, bounds.Max.Y),
+		)
+	}
+	return rects
+}
+
+func NewFingerprint(img image.Image, crops bool) *Fingerprint {
+	f := &Fingerprint{Variants: NewGrid(img).Variants()}
+	sub, ok := img.(subImager)
+	if !crops || !ok {
+		return f
+	}
+	for _, rect := range cropRects(img.Bounds()) {
+		if rect.Empty() {
+			continue
+		}
+		f.Crops = append(f.Crops, NewGrid(sub.SubImage(rect)).Hash())
+	}
+	return f
+}
@@ -0,0 +1,53 @@
+package phash
+
+type Transform int
+
+const (
+	Identity Transform = iota
+	Rotate90
+	Rotate180
+	Rotate270
+	FlipHorizontal
+	FlipVertical
+	Transpose
+	Transverse
+	TransformCount
+)
+
+var transformNames = [TransformCount]string{
+	"none",
+	"rotate 90",
+	"rotate 180",
+	"rotate 270",
+	"flip horizontal",
+	"flip vertical",
+	"transpose",
+	"transverse",
+}
+
+func (t Transform) String() string {
+	if t < 0 || t >= TransformCount {
+		return "unknown"
+	}
+	return transformNames[t]
+}
+
+func (t Transform) source(x, y, n int) (int, int) {
+	switch t {
+	case Rotate90:
+		return y, n - 1 - x
+	case Rotate180:
+		return n - 1 - x, n - 1 - y
+	case Rotate270:
+		return n - 1 - y, x
+	case FlipHorizontal:
+		return n - 1 - x, y
+	case FlipVertical:
+		return x, n - 1 - y
+	case Transpose:
+		return y, x
+	case Transverse:
+		return n - 1 - y, n - 1 - x
+	}
+	return x, y
+}
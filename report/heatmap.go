@@ -0,0 +1,114 @@
+package report
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+const heatmapOverlaps = 5
+
+type Overlap struct {
+	Directory string `json:"directory"`
+	Files     int    `json:"files"`
+}
+
+type DirectoryHeat struct {
+	Directory        string    `json:"directory"`
+	Files            int       `json:"files"`
+	Duplicated       int       `json:"duplicated"`
+	ReclaimableBytes int64     `json:"reclaimable_bytes"`
+	Overlaps         []Overlap `json:"overlaps"`
+}
+
+func (d DirectoryHeat) Percent() int {
+	if d.Files == 0 {
+		return 0
+	}
+	return d.Duplicated * 100 / d.Files
+}
+
+func (r *Report) BuildHeatmap(files map[string]int) {
+	heat := make(map[string]*DirectoryHeat)
+	overlaps := make(map[string]map[string]int)
+	get := func(dir string) *DirectoryHeat {
+		d, ok := heat[dir]
+		if !ok {
+			d = &DirectoryHeat{Directory: dir, Files: files[dir]}
+			heat[dir] = d
+			overlaps[dir] = make(map[string]int)
+		}
+		return d
+	}
+
+	for _, g := range r.Groups {
+		dirs := make([]string, len(g.Members))
+		for k, m := range g.Members {
+			dirs[k] = memberDirectory(m)
+		}
+
+		for k, m := range g.Members {
+			d := get(dirs[k])
+			if !m.Keep {
+				d.ReclaimableBytes += m.Size
+			}
+
+			seen := make(map[string]bool)
+			for _, other := range dirs {
+				if other != dirs[k] && !seen[other] {
+					seen[other] = true
+					overlaps[dirs[k]][other]++
+				}
+			}
+			if len(seen) > 0 {
+				d.Duplicated++
+			}
+		}
+	}
+
+	r.Heatmap = make([]DirectoryHeat, 0, len(heat))
+	for dir, d := range heat {
+		for other, num := range overlaps[dir] {
+			d.Overlaps = append(d.Overlaps, Overlap{Directory: other, Files: num})
+		}
+		sort.Slice(d.Overlaps, func(a, b int) bool {
+			if d.Overlaps[a].Files != d.Overlaps[b].Files {
+				return d.Overlaps[a].Files > d.Overlaps[b].Files
+			}
+			return d.Overlaps[a].Directory < d.Overlaps[b].Directory
+		})
+		if len(d.Overlaps) > heatmapOverlaps {
+			d.Overlaps = d.Overlaps[:heatmapOverlaps]
+		}
+		if d.Overlaps == nil {
+			d.Overlaps = []Overlap{}
+		}
+		r.Heatmap = append(r.Heatmap, *d)
+	}
+
+	sort.Slice(r.Heatmap, func(a, b int) bool {
+		x, y := r.Heatmap[a], r.Heatmap[b]
+		if x.ReclaimableBytes != y.ReclaimableBytes {
+			return x.ReclaimableBytes > y.ReclaimableBytes
+		}
+		if x.Duplicated != y.Duplicated {
+			return x.Duplicated > y.Duplicated
+		}
+		return x.Directory < y.Directory
+	})
+}
+
+func (r *Report) rebuildHeatmap(removed map[string]bool) {
+	if r.Heatmap == nil {
+		return
+	}
+	files := make(map[string]int, len(r.Heatmap))
+	for _, d := range r.Heatmap {
+		files[d.Directory] = d.Files
+	}
+	for filename := range removed {
+		if dir := filepath.Dir(filename); files[dir] > 0 {
+			files[dir]--
+		}
+	}
+	r.BuildHeatmap(files)
+}
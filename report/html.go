@@ -0,0 +1,178 @@
+package report
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+const thumbnailSize = 160
+
+var errNoThumbnail = errors.New("No thumbnail for this file")
+
+var htmlFuncs = template.FuncMap{
+	"thumbnail": thumbnail,
+	"bytes":     FormatBytes,
+	"dimensions": func(m Member) string {
+		if m.Metadata == nil || m.Metadata.Width == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%dx%d", m.Metadata.Width, m.Metadata.Height)
+	},
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Doubles report</title>
+<style>
+body { font-family: sans-serif; margin: 20px; background: #f4f4f4; }
+.group { background: #fff; margin-bottom: 16px; padding: 12px; border-radius: 4px; }
+.members { display: flex; flex-wrap: wrap; gap: 12px; }
+.member { width: 200px; font-size: 12px; word-break: break-all; }
+.member img { max-width: 160px; max-height: 160px; display: block; margin-bottom: 4px; }
+.member.keep { outline: 2px solid #3a3; }
+.toolbar { position: sticky; top: 0; background: #f4f4f4; padding: 8px 0; }
+</style>
+</head>
+<body>
+<div class="toolbar">
+<strong>{{.Totals.Groups}}</strong> groups, <strong>{{.Totals.Redundant}}</strong> redundant files, <strong>{{bytes .Totals.ReclaimableBytes}}</strong> reclaimable
+{{if .Run.Interrupted}}<em>(interrupted, results are incomplete)</em>{{end}}
+<button onclick="exportSelection()">Export selection</button>
+</div>
+{{range .Groups}}
+<div class="group" data-id="{{.ID}}">
+<div class="members">
+{{range .Members}}
+<label class="member{{if .Keep}} keep{{end}}">
+{{with thumbnail .}}<img src="{{.}}">{{end}}
+<input type="checkbox" class="delete" value="{{.Path}}" data-size="{{.Size}}" data-hash="{{.Hash}}" data-archive="{{.Archive}}"{{if not .Keep}} checked{{end}}{{if .Archive}} disabled{{end}}> delete<br>
+{{.Path}}<br>
+{{bytes .Size}}{{with dimensions .}}, {{.}}{{end}}{{with .Transform}}, {{.}}{{end}}
+</label>
+{{end}}
+</div>
+</div>
+{{end}}
+<script>
+function exportSelection() {
+	var groups = [], unkept = [];
+	document.querySelectorAll(".group").forEach(function (group) {
+		var members = [], loose = 0, keepers = 0;
+		group.querySelectorAll("input.delete").forEach(function (box) {
+			var remove = box.checked && !box.disabled;
+			if (!box.disabled) {
+				loose++;
+				if (!remove) {
+					keepers++;
+				}
+			}
+			members.push({
+				path: box.value,
+				size: Number(box.dataset.size),
+				hash: box.dataset.hash,
+				archive: box.dataset.archive,
+				keep: !remove,
+				action: remove ? "delete" : "keep"
+			});
+		});
+		if (loose > 0 && keepers == 0) {
+			unkept.push(members[0].path);
+		}
+		groups.push({id: group.dataset.id, members: members});
+	});
+	if (unkept.length > 0) {
+		alert("Keep at least one file in every group:\n" + unkept.join("\n"));
+		return;
+	}
+	var data = JSON.stringify({schema_version: {{.SchemaVersion}}, groups: groups}, null, "\t");
+	var link = document.createElement("a");
+	link.href = URL.createObjectURL(new Blob([data], {type: "application/json"}));
+	link.download = "selection.json";
+	link.click();
+}
+</script>
+</body>
+</html>
+`))
+
+func FormatBytes(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+func WriteThumbnail(w io.Writer, m Member) error {
+	if len(m.Archive) > 0 || !strings.HasPrefix(m.MimeType, "image/") {
+		return errNoThumbnail
+	}
+	file, err := os.Open(m.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, resize(img, thumbnailSize), &jpeg.Options{Quality: 75})
+}
+
+func thumbnail(m Member) template.URL {
+	buffer := &bytes.Buffer{}
+	if err := WriteThumbnail(buffer, m); err != nil {
+		return ""
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()))
+}
+
+func resize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	if width > height {
+		width, height = size, height*size/width
+	} else {
+		width, height = width*size/height, size
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dst.Set(x, y, img.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+	return dst
+}
+
+func writeHTML(w io.Writer, r *Report) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,182 @@
+package report
+
+import (
+	"doubles/metadata"
+	. "doubles/types"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const SchemaVersion = 1
+
+const (
+	ActionKeep   = "keep"
+	ActionDelete = "delete"
+)
+
+var (
+	errUnknownFormat = errors.New("Unknown report format")
+	errVersion       = errors.New("Unsupported report schema version")
+)
+
+type Run struct {
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Duration    float64   `json:"duration"`
+	Host        string    `json:"host"`
+	Directory   string    `json:"directory"`
+	Mode        string    `json:"mode"`
+	Options     *Options  `json:"options"`
+	Interrupted bool      `json:"interrupted,omitempty"`
+}
+
+type Member struct {
+	Path      string             `json:"path"`
+	Size      int64              `json:"size"`
+	ModTime   time.Time          `json:"mod_time"`
+	Inode     uint64             `json:"inode,omitempty"`
+	Hash      string             `json:"hash"`
+	Keep      bool               `json:"keep"`
+	Action    string             `json:"action,omitempty"`
+	MimeType  string             `json:"mime_type"`
+	Archive   string             `json:"archive,omitempty"`
+	Transform string             `json:"transform,omitempty"`
+	Metadata  *metadata.Metadata `json:"metadata,omitempty"`
+}
+
+func (m Member) ShouldDelete() bool {
+	if len(m.Action) > 0 {
+		return m.Action == ActionDelete
+	}
+	return !m.Keep
+}
+
+type Group struct {
+	ID      string   `json:"id"`
+	Members []Member `json:"members"`
+}
+
+type Totals struct {
+	Files            int   `json:"files"`
+	ArchiveEntries   int   `json:"archive_entries"`
+	Groups           int   `json:"groups"`
+	Members          int   `json:"members"`
+	Redundant        int   `json:"redundant"`
+	ReclaimableBytes int64 `json:"reclaimable_bytes"`
+}
+
+type Changes struct {
+	Since          time.Time `json:"since"`
+	New            []string  `json:"new"`
+	Modified       []string  `json:"modified"`
+	Deleted        []string  `json:"deleted"`
+	NewGroups      []string  `json:"new_groups"`
+	ResolvedGroups []string  `json:"resolved_groups"`
+}
+
+type Report struct {
+	SchemaVersion        int                `json:"schema_version"`
+	Run                  Run                `json:"run"`
+	Groups               []Group            `json:"groups"`
+	Directories          []DirectoryDoubles `json:"directories,omitempty"`
+	ContainedDirectories []DirectorySubset  `json:"contained_directories,omitempty"`
+	Heatmap              []DirectoryHeat    `json:"heatmap,omitempty"`
+	Totals               Totals             `json:"totals"`
+	Summary              *Summary           `json:"summary,omitempty"`
+	Changes              *Changes           `json:"changes,omitempty"`
+	Errors               []FileError        `json:"errors"`
+}
+
+func NewMember(image *Image, keep bool) Member {
+	return Member{
+		Path:      image.Path,
+		Size:      image.Size,
+		ModTime:   image.ModTime,
+		Inode:     image.Inode,
+		Hash:      image.Hash,
+		Keep:      keep,
+		MimeType:  image.MimeType,
+		Archive:   image.Archive,
+		Transform: image.Transform,
+		Metadata:  image.Metadata,
+	}
+}
+
+func (r *Report) AddGroup(id string, members []Member) {
+	r.Groups = append(r.Groups, Group{ID: id, Members: members})
+	r.Totals.Groups++
+	for _, m := range members {
+		r.Totals.Members++
+		if !m.Keep {
+			r.Totals.Redundant++
+			r.Totals.ReclaimableBytes += m.Size
+		}
+	}
+}
+
+func (r *Report) Finish() {
+	r.Run.Finished = time.Now()
+	r.Run.Duration = r.Run.Finished.Sub(r.Run.Started).Seconds()
+	if r.Groups == nil {
+		r.Groups = []Group{}
+	}
+	if r.Errors == nil {
+		r.Errors = []FileError{}
+	}
+}
+
+func Load(filename string) (*Report, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (*Report, error) {
+	r := &Report{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	if r.SchemaVersion != SchemaVersion {
+		return nil, errVersion
+	}
+	return r, nil
+}
+
+func NewReport(options *Options, mode string, started time.Time) *Report {
+	host, _ := os.Hostname()
+	return &Report{
+		SchemaVersion: SchemaVersion,
+		Run: Run{
+			Started:   started,
+			Host:      host,
+			Directory: options.Directory,
+			Mode:      mode,
+			Options:   options,
+		},
+	}
+}
+
+func (r *Report) RemoveMembers(paths map[string]bool) {
+	groups := r.Groups
+	r.Groups = []Group{}
+	r.Totals.Groups, r.Totals.Members, r.Totals.Redundant, r.Totals.ReclaimableBytes = 0, 0, 0, 0
+
+	for _, g := range groups {
+		members := make([]Member, 0, len(g.Members))
+		for _, m := range g.Members {
+			if !paths[m.Path] {
+				members = append(members, m)
+			}
+		}
+		if len(members) > 1 {
+			r.AddGroup(g.ID, members)
+		}
+	}
+	r.summarizeGroups()
+	r.rebuildHeatmap(paths)
+}
@@ -0,0 +1,28 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+)
+
+var errPathSelection = errors.New("Selection lists paths without groups, export it again from the HTML report")
+
+// A selection exported from the HTML report is a report with an action on
+// every member, so it is applied like an edited report.
+func LoadSelection(filename string) (*Report, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var paths struct {
+		Delete []string `json:"delete"`
+	}
+	if err := json.Unmarshal(data, &paths); err != nil {
+		return nil, err
+	}
+	if paths.Delete != nil {
+		return nil, errPathSelection
+	}
+	return parse(data)
+}
@@ -0,0 +1,105 @@
+package report
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+const summaryLimit = 10
+
+type Phase struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration"`
+}
+
+type GroupSize struct {
+	ID               string `json:"id"`
+	Members          int    `json:"members"`
+	Bytes            int64  `json:"bytes"`
+	ReclaimableBytes int64  `json:"reclaimable_bytes"`
+}
+
+type DirectoryCount struct {
+	Directory        string `json:"directory"`
+	Duplicates       int    `json:"duplicates"`
+	Redundant        int    `json:"redundant"`
+	ReclaimableBytes int64  `json:"reclaimable_bytes"`
+}
+
+type Summary struct {
+	FilesWalked   int              `json:"files_walked"`
+	FilesHashed   int              `json:"files_hashed"`
+	BytesHashed   int64            `json:"bytes_hashed"`
+	LargestGroups []GroupSize      `json:"largest_groups"`
+	Directories   []DirectoryCount `json:"directories"`
+	Phases        []Phase          `json:"phases"`
+}
+
+func memberDirectory(m Member) string {
+	if len(m.Archive) > 0 {
+		return filepath.Dir(m.Archive)
+	}
+	return filepath.Dir(m.Path)
+}
+
+func (r *Report) Summarize(walked, hashed int, bytesHashed int64, phases []Phase) {
+	r.Summary = &Summary{
+		FilesWalked: walked,
+		FilesHashed: hashed,
+		BytesHashed: bytesHashed,
+		Phases:      phases,
+	}
+	r.summarizeGroups()
+}
+
+func (r *Report) summarizeGroups() {
+	if r.Summary == nil {
+		return
+	}
+
+	groups := make([]GroupSize, 0, len(r.Groups))
+	counts := make(map[string]*DirectoryCount)
+	for _, g := range r.Groups {
+		size := GroupSize{ID: g.ID, Members: len(g.Members)}
+		for _, m := range g.Members {
+			dir := memberDirectory(m)
+			count, ok := counts[dir]
+			if !ok {
+				count = &DirectoryCount{Directory: dir}
+				counts[dir] = count
+			}
+			count.Duplicates++
+			size.Bytes += m.Size
+			if !m.Keep {
+				count.Redundant++
+				count.ReclaimableBytes += m.Size
+				size.ReclaimableBytes += m.Size
+			}
+		}
+		groups = append(groups, size)
+	}
+
+	sort.SliceStable(groups, func(a, b int) bool {
+		return groups[a].ReclaimableBytes > groups[b].ReclaimableBytes
+	})
+	if len(groups) > summaryLimit {
+		groups = groups[:summaryLimit]
+	}
+
+	directories := make([]DirectoryCount, 0, len(counts))
+	for _, count := range counts {
+		directories = append(directories, *count)
+	}
+	sort.Slice(directories, func(a, b int) bool {
+		if directories[a].ReclaimableBytes != directories[b].ReclaimableBytes {
+			return directories[a].ReclaimableBytes > directories[b].ReclaimableBytes
+		}
+		if directories[a].Duplicates != directories[b].Duplicates {
+			return directories[a].Duplicates > directories[b].Duplicates
+		}
+		return directories[a].Directory < directories[b].Directory
+	})
+
+	r.Summary.LargestGroups = groups
+	r.Summary.Directories = directories
+}
@@ -0,0 +1,126 @@
+package report
+
+import (
+	. "doubles/types"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{"group", "path", "size", "mod_time", "inode", "keep", "mime_type", "archive", "transform"}
+
+type line struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type header struct {
+	SchemaVersion int `json:"schema_version"`
+	Run           Run `json:"run"`
+}
+
+func writeJSON(w io.Writer, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func writeJSONL(w io.Writer, r *Report) error {
+	encoder := json.NewEncoder(w)
+	lines := []line{{Type: "header", Data: header{SchemaVersion: r.SchemaVersion, Run: r.Run}}}
+	for _, g := range r.Groups {
+		lines = append(lines, line{Type: "group", Data: g})
+	}
+	for _, d := range r.Directories {
+		lines = append(lines, line{Type: "directory", Data: d})
+	}
+	for _, d := range r.ContainedDirectories {
+		lines = append(lines, line{Type: "contained_directory", Data: d})
+	}
+	for _, d := range r.Heatmap {
+		lines = append(lines, line{Type: "heatmap", Data: d})
+	}
+	for _, e := range r.Errors {
+		lines = append(lines, line{Type: "error", Data: e})
+	}
+	if r.Changes != nil {
+		lines = append(lines, line{Type: "changes", Data: r.Changes})
+	}
+	lines = append(lines, line{Type: "totals", Data: r.Totals})
+	if r.Summary != nil {
+		lines = append(lines, line{Type: "summary", Data: r.Summary})
+	}
+
+	for _, l := range lines {
+		if err := encoder.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, r *Report) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, g := range r.Groups {
+		for _, m := range g.Members {
+			record := []string{
+				g.ID,
+				m.Path,
+				strconv.FormatInt(m.Size, 10),
+				m.ModTime.Format(time.RFC3339),
+				strconv.FormatUint(m.Inode, 10),
+				strconv.FormatBool(m.Keep),
+				m.MimeType,
+				m.Archive,
+				m.Transform,
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func Write(w io.Writer, r *Report, format string) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, r)
+	case FormatJSONL:
+		return writeJSONL(w, r)
+	case FormatCSV:
+		return writeCSV(w, r)
+	case FormatHTML:
+		return writeHTML(w, r)
+	}
+	return errUnknownFormat
+}
+
+func Save(filename string, r *Report, format string) error {
+	if filename == "-" {
+		return Write(os.Stdout, r, format)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := Write(file, r, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func IsFormatValid(format string) bool {
+	return format == FormatJSON || format == FormatJSONL || format == FormatCSV || format == FormatHTML
+}
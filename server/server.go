@@ -0,0 +1,540 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	. "doubles/config"
+	"doubles/database"
+	"doubles/doubles"
+	"doubles/report"
+	. "doubles/types"
+	"doubles/utils"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	statusRunning   = "running"
+	statusDone      = "done"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+var (
+	errNotFound   = errors.New("Not found")
+	errMethod     = errors.New("Method not allowed")
+	errNotDone    = errors.New("Scan has not finished")
+	errNotRunning = errors.New("Scan is not running")
+	errBadAction  = errors.New("Unknown action")
+	errNoActions  = errors.New("No actions given")
+	errBadPaging  = errors.New("Invalid offset or limit")
+	errBadFilter  = errors.New("Invalid filter")
+	errNotInGroup = errors.New("File is not a member of any group")
+	errHost       = errors.New("Host not allowed")
+	errOrigin     = errors.New("Cross-origin requests are not allowed")
+	errMediaType  = errors.New("Content-Type must be application/json")
+	errToken      = errors.New("Missing or invalid token")
+	errRemote     = errors.New("The token is only given to local clients")
+)
+
+const TokenHeader = "X-Doubles-Token"
+
+//go:embed ui
+var assets embed.FS
+
+var ui, _ = fs.Sub(assets, "ui")
+
+type Finder interface {
+	FindContext(ctx context.Context) (*report.Report, error)
+	Progress() doubles.Progress
+}
+
+type Action struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+}
+
+type actionsRequest struct {
+	Actions []Action `json:"actions"`
+}
+
+type groupsPage struct {
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+	Groups []report.Group `json:"groups"`
+}
+
+type job struct {
+	ID       string           `json:"id"`
+	Status   string           `json:"status"`
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Options  *Options         `json:"options"`
+	Progress doubles.Progress `json:"progress"`
+	Totals   *report.Totals   `json:"totals,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	finder   Finder
+	cancel   context.CancelFunc
+	report   *report.Report
+}
+
+type Server struct {
+	NewFinder   func(options *Options, config *Config) Finder
+	Apply       func(ctx context.Context, groups []report.Group) *doubles.ApplyResult
+	Token       string
+	AllowRemote bool
+	ctx         context.Context
+	config      *Config
+	ui          http.Handler
+	mux         sync.Mutex
+	database    sync.Mutex
+	jobs        []*job
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Keep:           KeepFirst,
+		Threshold:      10,
+		TrackThreshold: 6,
+		Frames:         FramesFirst,
+		Format:         FormatJSON,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) find(id string) *job {
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (s *Server) snapshot(j *job) job {
+	current := *j
+	if j.Status == statusRunning {
+		current.Progress = j.finder.Progress()
+	}
+	if j.report != nil {
+		totals := j.report.Totals
+		current.Totals = &totals
+	}
+	return current
+}
+
+func (s *Server) listScans(w http.ResponseWriter) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	list := make([]job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, s.snapshot(j))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) startScan(w http.ResponseWriter, r *http.Request) {
+	options := defaultOptions()
+	if err := json.NewDecoder(r.Body).Decode(options); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	options.Delete = false
+	if err := doubles.Validate(options); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	j := &job{
+		ID:      strconv.Itoa(len(s.jobs) + 1),
+		Status:  statusRunning,
+		Started: time.Now(),
+		Options: options,
+		finder:  s.NewFinder(options, s.config),
+	}
+	s.jobs = append(s.jobs, j)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	j.cancel = cancel
+	go func() {
+		defer cancel()
+		if options.Incremental {
+			s.database.Lock()
+			defer s.database.Unlock()
+		}
+		res, err := j.finder.FindContext(ctx)
+
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		j.Finished = time.Now()
+		j.Progress = j.finder.Progress()
+		if err != nil && err == ctx.Err() {
+			j.Status = statusCancelled
+			return
+		}
+		if err != nil {
+			j.Status = statusFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = statusDone
+		j.report = res
+	}()
+
+	writeJSON(w, http.StatusAccepted, s.snapshot(j))
+}
+
+func (s *Server) getScan(w http.ResponseWriter, id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	j := s.find(id)
+	if j == nil {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.snapshot(j))
+}
+
+func (s *Server) cancelScan(w http.ResponseWriter, id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	j := s.find(id)
+	if j == nil {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	if j.Status != statusRunning {
+		writeError(w, http.StatusConflict, errNotRunning)
+		return
+	}
+	j.cancel()
+	writeJSON(w, http.StatusAccepted, s.snapshot(j))
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func (s *Server) finishedReport(w http.ResponseWriter, id string) *report.Report {
+	j := s.find(id)
+	if j == nil {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return nil
+	}
+	if j.report == nil {
+		writeError(w, http.StatusConflict, errNotDone)
+		return nil
+	}
+	return j.report
+}
+
+func matchesFilter(m report.Member, dir string, minSize int) bool {
+	if len(dir) > 0 && !database.IsUnder(m.Path, dir) {
+		return false
+	}
+	return m.Size >= int64(minSize)
+}
+
+func filterGroups(groups []report.Group, dir string, minSize int) []report.Group {
+	if len(dir) == 0 && minSize == 0 {
+		return groups
+	}
+	var filtered []report.Group
+	for _, g := range groups {
+		for _, m := range g.Members {
+			if matchesFilter(m, dir, minSize) {
+				filtered = append(filtered, g)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func (s *Server) getGroups(w http.ResponseWriter, r *http.Request, id string) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, errBadPaging)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		writeError(w, http.StatusBadRequest, errBadPaging)
+		return
+	}
+	minSize, err := queryInt(r, "min_size", 0)
+	if err != nil || minSize < 0 {
+		writeError(w, http.StatusBadRequest, errBadFilter)
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	res := s.finishedReport(w, id)
+	if res == nil {
+		return
+	}
+
+	groups := filterGroups(res.Groups, r.URL.Query().Get("dir"), minSize)
+	page := groupsPage{Total: len(groups), Offset: offset, Limit: limit, Groups: []report.Group{}}
+	if offset < len(groups) {
+		end := offset + limit
+		if end > len(groups) {
+			end = len(groups)
+		}
+		page.Groups = groups[offset:end]
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) applyActions(w http.ResponseWriter, r *http.Request, id string) {
+	req := &actionsRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Actions) == 0 {
+		writeError(w, http.StatusBadRequest, errNoActions)
+		return
+	}
+	actions := make(map[string]string)
+	for _, a := range req.Actions {
+		if a.Action != report.ActionKeep && a.Action != report.ActionDelete {
+			writeError(w, http.StatusBadRequest, errBadAction)
+			return
+		}
+		actions[a.Path] = a.Action
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	res := s.finishedReport(w, id)
+	if res == nil {
+		return
+	}
+
+	var groups []report.Group
+	found := 0
+	for _, g := range res.Groups {
+		group := report.Group{ID: g.ID}
+		selected := false
+		for _, m := range g.Members {
+			if action, ok := actions[m.Path]; ok {
+				m.Action = action
+				selected = true
+				found++
+			} else {
+				m.Action = report.ActionKeep
+			}
+			group.Members = append(group.Members, m)
+		}
+		if selected {
+			groups = append(groups, group)
+		}
+	}
+	if found < len(actions) {
+		writeError(w, http.StatusBadRequest, errNotInGroup)
+		return
+	}
+
+	result := s.Apply(r.Context(), groups)
+	deleted := make(map[string]bool)
+	for _, filename := range result.Deleted {
+		deleted[filename] = true
+	}
+	res.RemoveMembers(deleted)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) getThumbnail(w http.ResponseWriter, r *http.Request, id string) {
+	filename := r.URL.Query().Get("path")
+
+	s.mux.Lock()
+	res := s.finishedReport(w, id)
+	var member *report.Member
+	if res != nil {
+		for _, g := range res.Groups {
+			for k := range g.Members {
+				if g.Members[k].Path == filename {
+					member = &g.Members[k]
+				}
+			}
+		}
+	}
+	s.mux.Unlock()
+
+	if res == nil {
+		return
+	}
+	if member == nil {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := report.WriteThumbnail(buffer, *member); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	buffer.WriteTo(w)
+}
+
+func route(path string) (string, string) {
+	if !strings.HasPrefix(path, "/api/scans") {
+		return "", ""
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/"), "/"), "/")
+	switch {
+	case parts[0] != "scans":
+		return "", ""
+	case len(parts) == 1:
+		return "scans", ""
+	case len(parts) == 2:
+		return "scan", parts[1]
+	case len(parts) == 3 && (parts[2] == "groups" || parts[2] == "actions" || parts[2] == "thumbnail" || parts[2] == "cancel"):
+		return parts[2], parts[1]
+	}
+	return "", ""
+}
+
+func hostname(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	return strings.Trim(host, "[]")
+}
+
+// isAllowedHost only accepts the loopback address, or any literal IP when
+// remote access is allowed, so a page on another domain can not reach the
+// API by rebinding its name to one of these addresses.
+func (s *Server) isAllowedHost(hostport string) bool {
+	host := hostname(hostport)
+	if s.AllowRemote && net.ParseIP(host) != nil {
+		return true
+	}
+	return utils.IsLoopback(host)
+}
+
+// authorize rejects requests a foreign page in the user's browser could send:
+// cross-origin calls, "simple" form or text/plain posts and posts without the
+// token the embedded UI fetches from the same origin.
+func (s *Server) authorize(r *http.Request) (int, error) {
+	if origin := r.Header.Get("Origin"); len(origin) > 0 {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			return http.StatusForbidden, errOrigin
+		}
+	}
+	if r.Method != http.MethodPost {
+		return 0, nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, errMediaType
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), []byte(s.Token)) != 1 {
+		return http.StatusForbidden, errToken
+	}
+	return 0, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.isAllowedHost(r.Host) {
+		writeError(w, http.StatusForbidden, errHost)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		s.ui.ServeHTTP(w, r)
+		return
+	}
+	if status, err := s.authorize(r); err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	name, id := route(r.URL.Path)
+	switch {
+	case r.URL.Path == "/api/token" && r.Method == http.MethodGet:
+		if !utils.IsLoopback(hostname(r.RemoteAddr)) {
+			writeError(w, http.StatusForbidden, errRemote)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"token": s.Token})
+	case len(name) == 0:
+		writeError(w, http.StatusNotFound, errNotFound)
+	case name == "scans" && r.Method == http.MethodGet:
+		s.listScans(w)
+	case name == "scans" && r.Method == http.MethodPost:
+		s.startScan(w, r)
+	case name == "scan" && r.Method == http.MethodGet:
+		s.getScan(w, id)
+	case name == "groups" && r.Method == http.MethodGet:
+		s.getGroups(w, r, id)
+	case name == "actions" && r.Method == http.MethodPost:
+		s.applyActions(w, r, id)
+	case name == "thumbnail" && r.Method == http.MethodGet:
+		s.getThumbnail(w, r, id)
+	case name == "cancel" && r.Method == http.MethodPost:
+		s.cancelScan(w, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errMethod)
+	}
+}
+
+func newToken() string {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buffer)
+}
+
+// New serves scans that are cancelled together with ctx.
+func New(ctx context.Context, config *Config) *Server {
+	return &Server{
+		NewFinder: func(options *Options, config *Config) Finder {
+			return doubles.NewFinder(options, config)
+		},
+		Apply:  doubles.Apply,
+		Token:  newToken(),
+		ctx:    ctx,
+		config: config,
+		ui:     http.FileServer(http.FS(ui)),
+	}
+}
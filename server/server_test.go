@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	. "doubles/config"
+	"doubles/doubles"
+	"doubles/report"
+	. "doubles/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type stubFinder struct {
+	res   *report.Report
+	block bool
+}
+
+func (f *stubFinder) FindContext(ctx context.Context) (*report.Report, error) {
+	if f.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return f.res, nil
+}
+
+func (f *stubFinder) Progress() doubles.Progress {
+	return doubles.Progress{}
+}
+
+func stubReport(dir string) *report.Report {
+	res := report.NewReport(&Options{Directory: dir}, "exact", time.Now())
+	res.AddGroup("g1", []report.Member{
+		{Path: dir + "/a.jpg", Size: 10, Hash: "h1", Keep: true},
+		{Path: dir + "/b.jpg", Size: 10, Hash: "h1"},
+	})
+	res.AddGroup("g2", []report.Member{
+		{Path: dir + "/c.jpg", Size: 20, Hash: "h2", Keep: true},
+		{Path: dir + "/d.jpg", Size: 20, Hash: "h2"},
+	})
+	res.Finish()
+	return res
+}
+
+type testServer struct {
+	*httptest.Server
+	applied [][]report.Group
+	dir     string
+	block   bool
+}
+
+func newTestServer(t *testing.T, block bool) *testServer {
+	ts := &testServer{dir: t.TempDir(), block: block}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s := New(ctx, NewConfig())
+	s.Token = "secret"
+	s.NewFinder = func(options *Options, config *Config) Finder {
+		return &stubFinder{res: stubReport(ts.dir), block: block}
+	}
+	s.Apply = func(ctx context.Context, groups []report.Group) *doubles.ApplyResult {
+		ts.applied = append(ts.applied, groups)
+		result := &doubles.ApplyResult{Deleted: []string{}, Skipped: []FileError{}}
+		for _, g := range groups {
+			for _, m := range g.Members {
+				if m.ShouldDelete() {
+					result.Deleted = append(result.Deleted, m.Path)
+				}
+			}
+		}
+		return result
+	}
+	ts.Server = httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *testServer) do(t *testing.T, method, path string, body interface{}, headers map[string]string) (int, map[string]interface{}) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(TokenHeader, "secret")
+	}
+	for name, value := range headers {
+		if len(value) == 0 {
+			req.Header.Del(name)
+		} else {
+			req.Header.Set(name, value)
+		}
+	}
+	if host, ok := headers["Host"]; ok {
+		req.Host = host
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var data map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&data)
+	return res.StatusCode, data
+}
+
+func (ts *testServer) startScan(t *testing.T) string {
+	status, data := ts.do(t, http.MethodPost, "/api/scans", map[string]string{"directory": ts.dir}, nil)
+	if status != http.StatusAccepted {
+		t.Fatalf("start scan: got status %d, %v", status, data)
+	}
+	id := data["id"].(string)
+	if !ts.block {
+		ts.wait(t, id, statusDone)
+	}
+	return id
+}
+
+func (ts *testServer) wait(t *testing.T, id, status string) {
+	for k := 0; k < 100; k++ {
+		_, data := ts.do(t, http.MethodGet, "/api/scans/"+id, nil, nil)
+		if data["status"] == status {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("scan did not reach status %s", status)
+}
+
+func TestStartScan(t *testing.T) {
+	ts := newTestServer(t, false)
+	id := ts.startScan(t)
+
+	_, data := ts.do(t, http.MethodGet, "/api/scans/"+id, nil, nil)
+	totals := data["totals"].(map[string]interface{})
+	if totals["groups"].(float64) != 2 {
+		t.Errorf("got %v groups, want 2", totals["groups"])
+	}
+
+	status, data := ts.do(t, http.MethodPost, "/api/scans", map[string]string{"directory": ts.dir + "/missing"}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("invalid directory: got status %d, %v", status, data)
+	}
+}
+
+func TestCancelScan(t *testing.T) {
+	ts := newTestServer(t, true)
+	id := ts.startScan(t)
+
+	if status, data := ts.do(t, http.MethodPost, "/api/scans/"+id+"/cancel", struct{}{}, nil); status != http.StatusAccepted {
+		t.Fatalf("got status %d, %v", status, data)
+	}
+	ts.wait(t, id, statusCancelled)
+
+	if status, _ := ts.do(t, http.MethodPost, "/api/scans/"+id+"/cancel", struct{}{}, nil); status != http.StatusConflict {
+		t.Errorf("cancel finished scan: got status %d, want %d", status, http.StatusConflict)
+	}
+	if status, _ := ts.do(t, http.MethodGet, "/api/scans/"+id+"/groups", nil, nil); status != http.StatusConflict {
+		t.Errorf("groups of cancelled scan: got status %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestGetGroups(t *testing.T) {
+	ts := newTestServer(t, false)
+	id := ts.startScan(t)
+
+	tests := []struct {
+		query  string
+		status int
+		total  int
+		groups int
+	}{
+		{"", http.StatusOK, 2, 2},
+		{"?limit=1", http.StatusOK, 2, 1},
+		{"?offset=1&limit=1", http.StatusOK, 2, 1},
+		{"?min_size=15", http.StatusOK, 1, 1},
+		{"?dir=/elsewhere", http.StatusOK, 0, 0},
+		{"?dir=" + ts.dir + "/", http.StatusOK, 2, 2},
+		{"?dir=" + ts.dir[:len(ts.dir)-1], http.StatusOK, 0, 0},
+		{"?limit=0", http.StatusBadRequest, 0, 0},
+		{"?offset=-1", http.StatusBadRequest, 0, 0},
+	}
+	for _, test := range tests {
+		status, data := ts.do(t, http.MethodGet, "/api/scans/"+id+"/groups"+test.query, nil, nil)
+		if status != test.status {
+			t.Errorf("%s: got status %d, want %d", test.query, status, test.status)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if total := int(data["total"].(float64)); total != test.total {
+			t.Errorf("%s: got total %d, want %d", test.query, total, test.total)
+		}
+		if groups := len(data["groups"].([]interface{})); groups != test.groups {
+			t.Errorf("%s: got %d groups, want %d", test.query, groups, test.groups)
+		}
+	}
+
+	if status, _ := ts.do(t, http.MethodGet, "/api/scans/42/groups", nil, nil); status != http.StatusNotFound {
+		t.Errorf("unknown scan: got status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestApplyActions(t *testing.T) {
+	ts := newTestServer(t, false)
+	id := ts.startScan(t)
+
+	actions := actionsRequest{Actions: []Action{{Path: ts.dir + "/b.jpg", Action: report.ActionDelete}}}
+	status, data := ts.do(t, http.MethodPost, "/api/scans/"+id+"/actions", actions, nil)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, %v", status, data)
+	}
+	if len(ts.applied) != 1 || len(ts.applied[0]) != 1 || ts.applied[0][0].ID != "g1" {
+		t.Fatalf("applied %v, want only group g1", ts.applied)
+	}
+	for _, m := range ts.applied[0][0].Members {
+		if want := strings.HasSuffix(m.Path, "/b.jpg"); m.ShouldDelete() != want {
+			t.Errorf("%s: delete is %v, want %v", m.Path, m.ShouldDelete(), want)
+		}
+	}
+
+	_, data = ts.do(t, http.MethodGet, "/api/scans/"+id+"/groups", nil, nil)
+	if total := int(data["total"].(float64)); total != 1 {
+		t.Errorf("got %d groups after delete, want 1", total)
+	}
+
+	bad := []actionsRequest{
+		{},
+		{Actions: []Action{{Path: ts.dir + "/c.jpg", Action: "move"}}},
+		{Actions: []Action{{Path: "/not/in/report.jpg", Action: report.ActionDelete}}},
+	}
+	for _, actions := range bad {
+		if status, _ := ts.do(t, http.MethodPost, "/api/scans/"+id+"/actions", actions, nil); status != http.StatusBadRequest {
+			t.Errorf("%v: got status %d, want %d", actions, status, http.StatusBadRequest)
+		}
+	}
+	if len(ts.applied) != 1 {
+		t.Errorf("invalid actions were applied: %v", ts.applied[1:])
+	}
+}
+
+func TestRejectsForeignRequests(t *testing.T) {
+	ts := newTestServer(t, false)
+	id := ts.startScan(t)
+	actions := actionsRequest{Actions: []Action{{Path: ts.dir + "/b.jpg", Action: report.ActionDelete}}}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"text/plain", map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"form", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType},
+		{"cross-origin", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"null origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"rebound host", map[string]string{"Host": "evil.example:8080"}, http.StatusForbidden},
+		{"remote host", map[string]string{"Host": "192.168.1.5:8080"}, http.StatusForbidden},
+		{"no token", map[string]string{TokenHeader: ""}, http.StatusForbidden},
+		{"wrong token", map[string]string{TokenHeader: "guess"}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if status, _ := ts.do(t, http.MethodPost, "/api/scans/"+id+"/actions", actions, test.headers); status != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, status, test.status)
+		}
+	}
+	if len(ts.applied) != 0 {
+		t.Errorf("foreign requests were applied: %v", ts.applied)
+	}
+
+	if status, _ := ts.do(t, http.MethodGet, "/api/token", nil, map[string]string{"Origin": "http://evil.example"}); status != http.StatusForbidden {
+		t.Errorf("cross-origin token request: got status %d, want %d", status, http.StatusForbidden)
+	}
+	status, data := ts.do(t, http.MethodGet, "/api/token", nil, map[string]string{"Origin": ts.URL})
+	if status != http.StatusOK || data["token"] != "secret" {
+		t.Errorf("same-origin token request: got status %d, %v", status, data)
+	}
+}
+
+func TestRemoteAccess(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowRemote bool
+		path        string
+		status      int
+	}{
+		{"scans", false, "/api/scans", http.StatusForbidden},
+		{"scans allowed", true, "/api/scans", http.StatusOK},
+		{"token", true, "/api/token", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		s := New(context.Background(), NewConfig())
+		s.AllowRemote = test.allowRemote
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Host = "192.168.1.5:8080"
+		req.RemoteAddr = "192.168.1.9:50000"
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+(function () {
+	var pageSize = 20;
+	var state = {scan: null, offset: 0, total: 0, filter: {}, actions: {}};
+
+	function $(id) {
+		return document.getElementById(id);
+	}
+
+	var token = fetch("/api/token").then(function (res) {
+		return res.json();
+	}).then(function (data) {
+		return data.token;
+	});
+
+	function request(method, url, body) {
+		return token.then(function (value) {
+			var options = {method: method, headers: {"X-Doubles-Token": value}};
+			if (body !== undefined) {
+				options.headers["Content-Type"] = "application/json";
+				options.body = JSON.stringify(body);
+			}
+			return fetch(url, options);
+		}).then(function (res) {
+			return res.json().then(function (data) {
+				if (!res.ok) {
+					throw new Error(data.error || res.statusText);
+				}
+				return data;
+			});
+		});
+	}
+
+	function formatBytes(size) {
+		var units = ["B", "KB", "MB", "GB", "TB"];
+		var unit = 0;
+		while (size >= 1024 && unit < units.length - 1) {
+			size /= 1024;
+			unit++;
+		}
+		return (unit === 0 ? size : size.toFixed(1)) + " " + units[unit];
+	}
+
+	function element(tag, className, text) {
+		var el = document.createElement(tag);
+		if (className) {
+			el.className = className;
+		}
+		if (text !== undefined) {
+			el.textContent = text;
+		}
+		return el;
+	}
+
+	function showError(err) {
+		$("result").innerHTML = "";
+		$("result").appendChild(element("div", "error", err.message));
+	}
+
+	function showStatus(scan) {
+		var p = scan.progress;
+		var text = "Scan " + scan.id + " of " + (scan.options.directory || scan.options.roots.join(", ")) + ": " + scan.status;
+		if (scan.status === "running") {
+			text += " (" + (p.phase || "starting") + ", " + p.walked + " walked, " + p.hashed + "/" + p.total + " hashed)";
+		} else if (scan.totals) {
+			text += ", " + scan.totals.groups + " groups, " + formatBytes(scan.totals.reclaimable_bytes) + " reclaimable";
+		} else if (scan.error) {
+			text += ": " + scan.error;
+		}
+		$("status").textContent = text;
+	}
+
+	function isKept(member) {
+		var action = state.actions[member.path];
+		return action ? action === "keep" : member.keep;
+	}
+
+	function renderMember(member) {
+		var el = element("div", "member");
+		var locked = !!member.archive;
+		if (locked) {
+			el.classList.add("locked");
+		}
+		if (isKept(member)) {
+			el.classList.add("keep");
+		}
+
+		if (member.mime_type.indexOf("image/") === 0 && !member.archive) {
+			var img = element("img");
+			img.loading = "lazy";
+			img.src = "/api/scans/" + state.scan.id + "/thumbnail?path=" + encodeURIComponent(member.path);
+			el.appendChild(img);
+		}
+		var action = element("div", "action", isKept(member) ? "keep" : "delete");
+		el.appendChild(action);
+		el.appendChild(element("div", "", member.path));
+
+		var details = [formatBytes(member.size)];
+		if (member.metadata && member.metadata.width) {
+			details.push(member.metadata.width + "x" + member.metadata.height);
+		}
+		if (member.transform) {
+			details.push(member.transform);
+		}
+		el.appendChild(element("div", "", details.join(", ")));
+
+		if (!locked) {
+			el.addEventListener("click", function () {
+				state.actions[member.path] = isKept(member) ? "delete" : "keep";
+				el.classList.toggle("keep", isKept(member));
+				action.textContent = isKept(member) ? "keep" : "delete";
+			});
+		}
+		return el;
+	}
+
+	function renderGroups(page) {
+		state.total = page.total;
+		state.groups = page.groups;
+		var from = page.total === 0 ? 0 : page.offset + 1;
+		$("page").textContent = from + "-" + (page.offset + page.groups.length) + " of " + page.total;
+		$("prev").disabled = page.offset === 0;
+		$("next").disabled = page.offset + page.groups.length >= page.total;
+
+		var container = $("groups");
+		container.innerHTML = "";
+		page.groups.forEach(function (group) {
+			var el = element("div", "group");
+			el.appendChild(element("h3", "", group.id));
+			var members = element("div", "members");
+			group.members.forEach(function (member) {
+				members.appendChild(renderMember(member));
+			});
+			el.appendChild(members);
+			container.appendChild(el);
+		});
+	}
+
+	function loadGroups() {
+		if (!state.scan || state.scan.status !== "done") {
+			$("groups").innerHTML = "";
+			return;
+		}
+		var query = "offset=" + state.offset + "&limit=" + pageSize;
+		if (state.filter.dir) {
+			query += "&dir=" + encodeURIComponent(state.filter.dir);
+		}
+		if (state.filter.minSize) {
+			query += "&min_size=" + state.filter.minSize;
+		}
+		request("GET", "/api/scans/" + state.scan.id + "/groups?" + query).then(renderGroups).catch(showError);
+	}
+
+	function poll(id) {
+		request("GET", "/api/scans/" + id).then(function (scan) {
+			state.scan = scan;
+			showStatus(scan);
+			if (scan.status === "running") {
+				setTimeout(function () {
+					poll(id);
+				}, 1000);
+				return;
+			}
+			state.offset = 0;
+			state.actions = {};
+			loadGroups();
+		}).catch(showError);
+	}
+
+	$("scan").addEventListener("submit", function (e) {
+		e.preventDefault();
+		var form = e.target;
+		var options = {directory: form.directory.value, similar: form.similar.checked};
+		request("POST", "/api/scans", options).then(function (scan) {
+			$("result").innerHTML = "";
+			poll(scan.id);
+		}).catch(showError);
+	});
+
+	$("filter").addEventListener("submit", function (e) {
+		e.preventDefault();
+		var form = e.target;
+		state.filter = {dir: form.dir.value, minSize: Math.round(parseFloat(form.min_size.value || "0") * 1024 * 1024)};
+		state.offset = 0;
+		loadGroups();
+	});
+
+	$("prev").addEventListener("click", function () {
+		state.offset = Math.max(0, state.offset - pageSize);
+		loadGroups();
+	});
+
+	$("next").addEventListener("click", function () {
+		state.offset += pageSize;
+		loadGroups();
+	});
+
+	$("apply").addEventListener("click", function () {
+		if (!state.groups || state.groups.length === 0) {
+			return;
+		}
+		var actions = [];
+		state.groups.forEach(function (group) {
+			group.members.forEach(function (member) {
+				if (!member.archive) {
+					actions.push({path: member.path, action: isKept(member) ? "keep" : "delete"});
+				}
+			});
+		});
+		var count = actions.filter(function (a) {
+			return a.action === "delete";
+		}).length;
+		if (count === 0 || !confirm("Delete " + count + " file(s) shown on this page?")) {
+			return;
+		}
+
+		request("POST", "/api/scans/" + state.scan.id + "/actions", {actions: actions}).then(function (result) {
+			var el = $("result");
+			el.innerHTML = "";
+			el.appendChild(element("div", "", "Deleted " + result.deleted.length + " file(s), reclaimed " + formatBytes(result.reclaimed_bytes)));
+			result.skipped.forEach(function (skipped) {
+				el.appendChild(element("div", "error", skipped.path + ": " + skipped.message));
+			});
+			state.actions = {};
+			loadGroups();
+		}).catch(showError);
+	});
+
+	request("GET", "/api/scans").then(function (scans) {
+		if (scans.length > 0) {
+			poll(scans[scans.length - 1].id);
+		}
+	}).catch(showError);
+})();
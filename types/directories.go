@@ -0,0 +1,244 @@
+package types
+
+import (
+	"crypto/md5"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type DirectoryDoubles struct {
+	Directories []string `json:"directories"`
+	Files       int      `json:"files"`
+	Size        int64    `json:"size"`
+}
+
+type DirectorySubset struct {
+	Directory string `json:"directory"`
+	Parent    string `json:"parent"`
+	Files     int    `json:"files"`
+}
+
+type OtherFile struct {
+	Size int64  `json:"size"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type directory struct {
+	path     string
+	files    []string
+	children []string
+	hash     string
+	contents map[string]int
+	count    int
+	size     int64
+}
+
+func isAncestor(dir, other string) bool {
+	return strings.HasPrefix(other, dir+string(filepath.Separator))
+}
+
+func (i *ImageCollection) directories(root string) map[string]*directory {
+	dirs := make(map[string]*directory)
+	var get func(path string) *directory
+	get = func(path string) *directory {
+		if d, ok := dirs[path]; ok {
+			return d
+		}
+		d := &directory{path: path, contents: make(map[string]int)}
+		dirs[path] = d
+		if parent := filepath.Dir(path); path != root && parent != path {
+			p := get(parent)
+			p.children = append(p.children, path)
+		}
+		return d
+	}
+
+	for hash, files := range i.hashes {
+		for _, filename := range files {
+			if len(i.images[filename].Archive) > 0 {
+				continue
+			}
+			d := get(filepath.Dir(filename))
+			d.files = append(d.files, hash)
+			if image, ok := i.images[filename]; ok {
+				d.size += image.Size
+			}
+		}
+	}
+	for filename, other := range i.others {
+		d := get(filepath.Dir(filename))
+		d.files = append(d.files, other.Hash)
+		d.size += other.Size
+	}
+
+	var resolve func(d *directory) string
+	resolve = func(d *directory) string {
+		if len(d.hash) > 0 {
+			return d.hash
+		}
+		entries := make([]string, 0, len(d.files)+len(d.children))
+		for _, hash := range d.files {
+			entries = append(entries, "f:"+hash)
+			d.contents[hash]++
+			d.count++
+		}
+		for _, path := range d.children {
+			child := dirs[path]
+			entries = append(entries, "d:"+resolve(child))
+			for hash, num := range child.contents {
+				d.contents[hash] += num
+			}
+			d.count += child.count
+			d.size += child.size
+		}
+		sort.Strings(entries)
+		d.hash = fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(entries, "\n"))))
+		return d.hash
+	}
+	for _, d := range dirs {
+		resolve(d)
+	}
+	return dirs
+}
+
+func (i *ImageCollection) AddOtherFile(filename string, other OtherFile) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.others[filename] = other
+}
+
+func (i *ImageCollection) OtherFiles() map[string]OtherFile {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	others := make(map[string]OtherFile, len(i.others))
+	for filename, other := range i.others {
+		others[filename] = other
+	}
+	return others
+}
+
+func (i *ImageCollection) DirectoryFiles() map[string]int {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	files := make(map[string]int)
+	for _, image := range i.images {
+		if len(image.Archive) > 0 {
+			files[filepath.Dir(image.Archive)]++
+		} else {
+			files[filepath.Dir(image.Path)]++
+		}
+	}
+	return files
+}
+
+func (i *ImageCollection) FindDirectories(root string) ([]DirectoryDoubles, []DirectorySubset) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	dirs := i.directories(filepath.Clean(root))
+
+	byHash := make(map[string][]string)
+	for path, d := range dirs {
+		byHash[d.hash] = append(byHash[d.hash], path)
+	}
+
+	identical := make(map[string]bool)
+	var doubles []DirectoryDoubles
+	for _, paths := range byHash {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			identical[path] = true
+		}
+
+		if isNested(dirs, paths) {
+			continue
+		}
+
+		d := dirs[paths[0]]
+		doubles = append(doubles, DirectoryDoubles{Directories: paths, Files: d.count, Size: d.size})
+	}
+	sort.Slice(doubles, func(a, b int) bool {
+		return doubles[a].Directories[0] < doubles[b].Directories[0]
+	})
+
+	holders := make(map[string][]string)
+	for path, d := range dirs {
+		for hash := range d.contents {
+			holders[hash] = append(holders[hash], path)
+		}
+	}
+
+	parents := make(map[string]string)
+	for path, d := range dirs {
+		if identical[path] || d.count == 0 {
+			continue
+		}
+		var rarest string
+		for hash := range d.contents {
+			if len(rarest) == 0 || len(holders[hash]) < len(holders[rarest]) {
+				rarest = hash
+			}
+		}
+
+		var parent string
+		for _, candidate := range holders[rarest] {
+			other := dirs[candidate]
+			if candidate == path || isAncestor(path, candidate) || isAncestor(candidate, path) || other.count <= d.count {
+				continue
+			}
+			if !d.isSubsetOf(other) {
+				continue
+			}
+			if len(parent) == 0 || other.count < dirs[parent].count || (other.count == dirs[parent].count && candidate < parent) {
+				parent = candidate
+			}
+		}
+		if len(parent) > 0 {
+			parents[path] = parent
+		}
+	}
+
+	var subsets []DirectorySubset
+	for path, parent := range parents {
+		if _, ok := parents[filepath.Dir(path)]; ok || identical[filepath.Dir(path)] {
+			continue
+		}
+		subsets = append(subsets, DirectorySubset{Directory: path, Parent: parent, Files: dirs[path].count})
+	}
+	sort.Slice(subsets, func(a, b int) bool {
+		return subsets[a].Directory < subsets[b].Directory
+	})
+
+	return doubles, subsets
+}
+
+// isNested reports whether every directory of an identical group sits in its
+// own parent and those parents are identical too, so the group is already
+// covered by the parents' group.
+func isNested(dirs map[string]*directory, paths []string) bool {
+	parents := make(map[string]bool)
+	hashes := make(map[string]bool)
+	for _, path := range paths {
+		parent, ok := dirs[filepath.Dir(path)]
+		if !ok || parent.path == path {
+			return false
+		}
+		parents[parent.path] = true
+		hashes[parent.hash] = true
+	}
+	return len(parents) == len(paths) && len(hashes) == 1
+}
+
+func (d *directory) isSubsetOf(other *directory) bool {
+	for hash, num := range d.contents {
+		if other.contents[hash] < num {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"crypto/md5"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func addTestFile(t *testing.T, i *ImageCollection, filename, content, mimeType string) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := md5.Sum([]byte(content))
+	i.AddFile(filename, info, mimeType)
+	i.AddHash(hash[:], filename)
+	if mimeType == "audio/mpeg" {
+		i.AddTrack(filename, hash[:])
+	}
+}
+
+func TestFindDirectoriesIncludesTracks(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		name      string
+		songs     [2]string
+		identical bool
+	}{
+		{"same songs", [2]string{"song", "song"}, true},
+		{"different songs", [2]string{"song", "other song"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i := NewImageCollection()
+			for k, dir := range []string{"a", "b"} {
+				dir = filepath.Join(root, test.name, dir)
+				addTestFile(t, i, filepath.Join(dir, "cover.jpg"), "cover", "image/jpeg")
+				addTestFile(t, i, filepath.Join(dir, "song.mp3"), test.songs[k], "audio/mpeg")
+			}
+
+			doubles, _ := i.FindDirectories(filepath.Join(root, test.name))
+			if identical := len(doubles) > 0; identical != test.identical {
+				t.Fatalf("got %v, want identical %v", doubles, test.identical)
+			}
+			if test.identical && doubles[0].Files != 2 {
+				t.Errorf("got %d files, want 2", doubles[0].Files)
+			}
+		})
+	}
+}
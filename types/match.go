@@ -0,0 +1,189 @@
+package types
+
+import (
+	"doubles/phash"
+	"sort"
+)
+
+func (i *ImageCollection) Remove(filename string) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	image, ok := i.images[filename]
+	if !ok {
+		return
+	}
+
+	list := i.hashes[image.Hash]
+	for k, v := range list {
+		if v == filename {
+			list = append(list[:k], list[k+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(i.hashes, image.Hash)
+	} else {
+		i.hashes[image.Hash] = list
+	}
+
+	for k, v := range i.files {
+		if v == filename {
+			i.files = append(i.files[:k], i.files[k+1:]...)
+			break
+		}
+	}
+	if i.restored[filename] {
+		delete(i.restored, filename)
+		i.reused--
+	}
+
+	delete(i.images, filename)
+	delete(i.phashes, filename)
+	i.unindexFingerprint(filename)
+	delete(i.videos, filename)
+	delete(i.tracks, filename)
+	delete(i.prints, filename)
+	i.compactIndex()
+}
+
+// RemoveUnder removes every file in dir and its subdirectories, including
+// the entries of archives stored there.
+func (i *ImageCollection) RemoveUnder(dir string) {
+	i.mux.Lock()
+	var files []string
+	for filename, image := range i.images {
+		if isAncestor(dir, filename) || len(image.Archive) > 0 && isAncestor(dir, image.Archive) {
+			files = append(files, filename)
+		}
+	}
+	i.mux.Unlock()
+
+	for _, filename := range files {
+		i.Remove(filename)
+	}
+}
+
+// maxDeadSlots is the share of removed files after which the index is rebuilt.
+const maxDeadSlots = 0.5
+
+// similarIndex keeps the fingerprints of the collection searchable as files
+// come and go in watch mode. Removed files leave an empty slot behind until
+// the index is rebuilt.
+type similarIndex struct {
+	index *phash.Index
+	files []string
+	ids   map[string]int
+	dead  int
+}
+
+// IndexFingerprints makes Matches search fingerprints through an index that
+// follows later changes to the collection, as watch mode needs.
+func (i *ImageCollection) IndexFingerprints() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.rebuildIndex()
+}
+
+func (i *ImageCollection) rebuildIndex() {
+	i.similar = &similarIndex{index: phash.NewIndex(), ids: make(map[string]int, len(i.phashes))}
+	for filename, fingerprint := range i.phashes {
+		i.indexFingerprint(filename, fingerprint)
+	}
+}
+
+func (i *ImageCollection) compactIndex() {
+	if i.similar != nil && float64(i.similar.dead) > maxDeadSlots*float64(len(i.similar.files)) {
+		i.rebuildIndex()
+	}
+}
+
+func (i *ImageCollection) indexFingerprint(filename string, fingerprint *phash.Fingerprint) {
+	if i.similar == nil {
+		return
+	}
+	i.unindexFingerprint(filename)
+	id := len(i.similar.files)
+	i.similar.files = append(i.similar.files, filename)
+	i.similar.ids[filename] = id
+	i.similar.index.Add(fingerprint.Hash(), id)
+	for _, hash := range fingerprint.Crops {
+		i.similar.index.Add(hash, id)
+	}
+}
+
+func (i *ImageCollection) unindexFingerprint(filename string) {
+	if i.similar == nil {
+		return
+	}
+	if id, ok := i.similar.ids[filename]; ok {
+		i.similar.files[id] = ""
+		delete(i.similar.ids, filename)
+		i.similar.dead++
+	}
+}
+
+func fingerprintDistance(a, b *phash.Fingerprint, options *Options) int {
+	variants := phash.TransformCount
+	if !options.Transforms {
+		variants = phash.Identity + 1
+	}
+	best := phash.Distance(a.Hash(), b.Hash())
+	for t := phash.Identity; t < variants; t++ {
+		if d := phash.Distance(a.Variants[t], b.Hash()); d < best {
+			best = d
+		}
+	}
+	if options.Crops {
+		for _, hash := range a.Crops {
+			if d := phash.Distance(hash, b.Hash()); d < best {
+				best = d
+			}
+		}
+		for _, hash := range b.Crops {
+			if d := phash.Distance(a.Hash(), hash); d < best {
+				best = d
+			}
+		}
+	}
+	return best
+}
+
+func (i *ImageCollection) Matches(filename string, options *Options) Doubles {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	image, ok := i.images[filename]
+	if !ok {
+		return nil
+	}
+
+	found := make(map[string]bool)
+	for _, other := range i.hashes[image.Hash] {
+		found[other] = true
+	}
+	if fingerprint, ok := i.phashes[filename]; ok && options.Similar && i.similar != nil {
+		variants := phash.TransformCount
+		if !options.Transforms {
+			variants = phash.Identity + 1
+		}
+		queries := append([]phash.Hash{}, fingerprint.Variants[:variants]...)
+		if options.Crops {
+			queries = append(queries, fingerprint.Crops...)
+		}
+		for _, hash := range queries {
+			i.similar.index.Query(hash, options.Threshold, func(id, distance int) {
+				other := i.similar.files[id]
+				if len(other) > 0 && !found[other] && fingerprintDistance(fingerprint, i.phashes[other], options) <= options.Threshold {
+					found[other] = true
+				}
+			})
+		}
+	}
+	delete(found, filename)
+
+	list := make(Doubles, 0, len(found))
+	for other := range found {
+		list = append(list, other)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,93 @@
+package types
+
+import "doubles/phash"
+
+type FileState struct {
+	Image       *Image             `json:"image"`
+	Fingerprint *phash.Fingerprint `json:"fingerprint,omitempty"`
+	Frames      []phash.Hash       `json:"frames,omitempty"`
+	Track       string             `json:"track,omitempty"`
+	TrackPrint  *phash.Hash        `json:"track_print,omitempty"`
+}
+
+func (i *ImageCollection) States() map[string]*FileState {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	states := make(map[string]*FileState, len(i.images))
+	for filename, image := range i.images {
+		if len(image.Hash) == 0 {
+			continue
+		}
+		copied := *image
+		state := &FileState{
+			Image:       &copied,
+			Fingerprint: i.phashes[filename],
+			Frames:      i.videos[filename],
+			Track:       i.tracks[filename],
+		}
+		if fingerprint, ok := i.prints[filename]; ok {
+			state.TrackPrint = &fingerprint
+		}
+		states[filename] = state
+	}
+	return states
+}
+
+func (i *ImageCollection) Pending() []*Image {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	var pending []*Image
+	for _, filename := range i.files {
+		if image := i.images[filename]; len(image.Hash) == 0 {
+			copied := *image
+			pending = append(pending, &copied)
+		}
+	}
+	return pending
+}
+
+func (i *ImageCollection) Restore(state *FileState) {
+	i.restore(state, true)
+}
+
+func (i *ImageCollection) Resume(state *FileState) {
+	i.restore(state, false)
+}
+
+func (i *ImageCollection) restore(state *FileState, restored bool) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	image := *state.Image
+	image.Transform = ""
+	filename := image.Path
+
+	i.images[filename] = &image
+	if restored {
+		i.restored[filename] = true
+	}
+	if len(image.Archive) > 0 {
+		i.entries++
+	} else {
+		i.reused++
+	}
+	i.hashes[image.Hash] = append(i.hashes[image.Hash], filename)
+	if state.Fingerprint != nil {
+		i.phashes[filename] = state.Fingerprint
+		i.indexFingerprint(filename, state.Fingerprint)
+	}
+	if len(state.Frames) > 0 {
+		i.videos[filename] = state.Frames
+	}
+	if len(state.Track) > 0 {
+		i.tracks[filename] = state.Track
+	}
+	if state.TrackPrint != nil {
+		i.prints[filename] = *state.TrackPrint
+	}
+}
+
+func (i *ImageCollection) IsRestored(filename string) bool {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.restored[filename]
+}
@@ -1,14 +1,40 @@
 package types
 
 import (
+	"crypto/md5"
+	"doubles/colors"
+	"doubles/metadata"
+	"doubles/phash"
 	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	KeepFirst    = "first"
+	KeepMetadata = "metadata"
+	KeepLargest  = "largest"
+)
 
-	colors "github.com/logrusorgru/aurora"
+const (
+	FramesFirst = "first"
+	FramesAll   = "all"
 )
 
 type Doubles []string
 
+// Key identifies a group by its members, since groups matched by fingerprint
+// can share a hash and groups of different modes end up in the same map.
+func (d Doubles) Key() string {
+	paths := append([]string{}, d...)
+	sort.Strings(paths)
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(paths, "\n"))))
+}
+
 func (d Doubles) String() string {
 	var res string
 	for k, v := range d {
@@ -20,31 +46,159 @@ func (d Doubles) String() string {
 	return res
 }
 
+const (
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+	FormatHTML  = "html"
+)
+
+const (
+	EventsLog     = "log"
+	EventsJSON    = "json"
+	EventsWebhook = "webhook"
+)
+
 type Options struct {
-	Directory string
-	Delete    bool
-	Dump      bool
-	Skip      []string
+	Directory      string            `json:"directory"`
+	Roots          []string          `json:"roots,omitempty"`
+	Delete         bool              `json:"delete"`
+	Dump           bool              `json:"dump"`
+	Skip           []string          `json:"skip"`
+	Keep           string            `json:"keep"`
+	Similar        bool              `json:"similar"`
+	Threshold      int               `json:"threshold"`
+	TrackThreshold int               `json:"track_threshold"`
+	Transforms     bool              `json:"transforms"`
+	Crops          bool              `json:"crops"`
+	Frames         string            `json:"frames"`
+	Video          bool              `json:"video"`
+	Audio          bool              `json:"audio"`
+	Dirs           bool              `json:"dirs"`
+	Heatmap        bool              `json:"heatmap"`
+	Archives       bool              `json:"archives"`
+	ArchiveKeeps   bool              `json:"archive_keeps"`
+	Format         string            `json:"format"`
+	Output         string            `json:"output,omitempty"`
+	Stream         string            `json:"stream,omitempty"`
+	Selection      string            `json:"selection,omitempty"`
+	Apply          string            `json:"apply,omitempty"`
+	Incremental    bool              `json:"incremental"`
+	Resume         bool              `json:"resume,omitempty"`
+	Watch          bool              `json:"watch"`
+	Events         string            `json:"events,omitempty"`
+	Webhook        string            `json:"webhook,omitempty"`
+	Serve          bool              `json:"-"`
+	Listen         string            `json:"-"`
+	AllowRemote    bool              `json:"-"`
+	Quiet          bool              `json:"-"`
+	Verbose        bool              `json:"-"`
+	LogFormat      string            `json:"-"`
+	Config         string            `json:"-"`
+	Settings       map[string]string `json:"-"`
+}
+
+type Image struct {
+	Path      string             `json:"path"`
+	Size      int64              `json:"size"`
+	ModTime   time.Time          `json:"mod_time"`
+	Inode     uint64             `json:"inode,omitempty"`
+	Hash      string             `json:"hash"`
+	MimeType  string             `json:"mime_type"`
+	Metadata  *metadata.Metadata `json:"metadata,omitempty"`
+	Transform string             `json:"transform,omitempty"`
+	Archive   string             `json:"archive,omitempty"`
+}
+
+type FileError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
 }
 
 type ImageCollection struct {
-	mux    sync.Mutex
-	files  []string
-	hashes map[string][]string
+	mux      sync.Mutex
+	files    []string
+	entries  int
+	reused   int
+	errors   []FileError
+	images   map[string]*Image
+	restored map[string]bool
+	hashes   map[string][]string
+	phashes  map[string]*phash.Fingerprint
+	videos   map[string][]phash.Hash
+	tracks   map[string]string
+	prints   map[string]phash.Hash
+	others   map[string]OtherFile
+	similar  *similarIndex
 }
 
 func (i *ImageCollection) Length() int {
-	return len(i.files)
+	return len(i.files) + i.reused
 }
 
 func (i *ImageCollection) Files() []string {
-	return i.files
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return append([]string{}, i.files...)
 }
 
-func (i *ImageCollection) AddFile(filename string) {
+func (i *ImageCollection) Image(filename string) *Image {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.images[filename]
+}
+
+func (i *ImageCollection) AddFile(filename string, info os.FileInfo, mimeType string) {
 	i.mux.Lock()
 	defer i.mux.Unlock()
 	i.files = append(i.files, filename)
+	i.images[filename] = &Image{
+		Path:     filename,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Inode:    inode(info),
+		MimeType: mimeType,
+	}
+}
+
+func (i *ImageCollection) AddError(filename string, err error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.errors = append(i.errors, FileError{Path: filename, Message: err.Error()})
+}
+
+func (i *ImageCollection) Errors() []FileError {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return append([]FileError{}, i.errors...)
+}
+
+func (i *ImageCollection) ArchiveEntries() int {
+	return i.entries
+}
+
+func (i *ImageCollection) AddArchiveEntry(filename, archive string, info os.FileInfo, mimeType string, hash []byte) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	filehash := fmt.Sprintf("%x", hash)
+	i.entries++
+	i.images[filename] = &Image{
+		Path:     filename,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Hash:     filehash,
+		MimeType: mimeType,
+		Archive:  archive,
+	}
+	i.hashes[filehash] = append(i.hashes[filehash], filename)
+}
+
+func (i *ImageCollection) SetMetadata(filename string, m *metadata.Metadata) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if image, ok := i.images[filename]; ok {
+		image.Metadata = m
+	}
 }
 
 func (i *ImageCollection) AddHash(hash []byte, filename string) {
@@ -52,22 +206,390 @@ func (i *ImageCollection) AddHash(hash []byte, filename string) {
 	defer i.mux.Unlock()
 	filehash := fmt.Sprintf("%x", hash)
 	i.hashes[filehash] = append(i.hashes[filehash], filename)
+	if image, ok := i.images[filename]; ok {
+		image.Hash = filehash
+	}
+}
+
+func (i *ImageCollection) AddFingerprint(filename string, fingerprint *phash.Fingerprint) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.phashes[filename] = fingerprint
+	i.indexFingerprint(filename, fingerprint)
+	i.compactIndex()
+}
+
+func (i *ImageCollection) AddVideoFingerprint(filename string, frames []phash.Hash) {
+	if len(frames) == 0 {
+		return
+	}
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.videos[filename] = frames
+}
+
+func (i *ImageCollection) AddTrack(filename string, hash []byte) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.tracks[filename] = fmt.Sprintf("%x", hash)
+}
+
+func (i *ImageCollection) AddTrackFingerprint(filename string, fingerprint phash.Hash) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.prints[filename] = fingerprint
+}
+
+func (i *ImageCollection) isGroupedSeparately(filename string) bool {
+	_, isVideo := i.videos[filename]
+	_, isTrack := i.tracks[filename]
+	return isVideo || isTrack
+}
+
+func (i *ImageCollection) Images(list Doubles) []*Image {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	images := make([]*Image, 0, len(list))
+	for _, filename := range list {
+		if image, ok := i.images[filename]; ok {
+			images = append(images, image)
+		}
+	}
+	return images
 }
 
 func (i *ImageCollection) FindDoubles() (int, map[string]Doubles) {
 	num := 0
 	doubles := make(map[string]Doubles)
 	for k, v := range i.hashes {
-		if len(v) > 1 {
-			doubles[k] = v
-			num += len(v)
+		var list Doubles
+		for _, filename := range v {
+			if !i.isGroupedSeparately(filename) {
+				list = append(list, filename)
+			}
+		}
+		if len(list) > 1 {
+			doubles[k] = list
+			num += len(list)
 		}
 	}
 	return num, doubles
 }
 
+type similarEntry struct {
+	file  int
+	match string
+}
+
+type similarMatch struct {
+	distance int
+	match    string
+}
+
+func (m similarMatch) better(other similarMatch) bool {
+	if m.distance != other.distance {
+		return m.distance < other.distance
+	}
+	return len(m.match) == 0 && len(other.match) > 0
+}
+
+func joinMatch(match, extra string) string {
+	if len(match) == 0 {
+		return extra
+	}
+	return match + ", " + extra
+}
+
+func (i *ImageCollection) FindSimilar(options *Options) (int, map[string]Doubles) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	files := make([]string, 0, len(i.phashes))
+	for filename := range i.phashes {
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+
+	threshold := options.Threshold
+	variants := phash.TransformCount
+	if !options.Transforms {
+		variants = phash.Identity + 1
+	}
+
+	index := phash.NewIndex()
+	var entries []similarEntry
+	for k, filename := range files {
+		fingerprint := i.phashes[filename]
+		for t := phash.Identity; t < variants; t++ {
+			match := ""
+			if t != phash.Identity {
+				match = t.String()
+			}
+			index.Add(fingerprint.Variants[t], len(entries))
+			entries = append(entries, similarEntry{file: k, match: match})
+		}
+		if options.Crops {
+			for _, hash := range fingerprint.Crops {
+				index.Add(hash, len(entries))
+				entries = append(entries, similarEntry{file: k, match: "crop"})
+			}
+		}
+	}
+
+	num := 0
+	doubles := make(map[string]Doubles)
+	grouped := make([]bool, len(files))
+
+	for k, anchor := range files {
+		if grouped[k] {
+			continue
+		}
+		grouped[k] = true
+
+		fingerprint := i.phashes[anchor]
+		matches := make(map[int]similarMatch)
+		consider := func(file int, m similarMatch) {
+			other := i.phashes[files[file]]
+			switch {
+			case fingerprint.Animated != other.Animated:
+				m.match = joinMatch(m.match, "first frame")
+			case options.Frames == FramesAll && fingerprint.Animated && (len(fingerprint.Frames) == 0 || len(other.Frames) == 0):
+				m.match = joinMatch(m.match, "first frame")
+			case options.Frames == FramesAll && len(m.match) == 0 && fingerprint.Animated:
+				if phash.FrameDistance(fingerprint.Frames, other.Frames) > threshold {
+					return
+				}
+			}
+			if best, ok := matches[file]; !ok || m.better(best) {
+				matches[file] = m
+			}
+		}
+
+		index.Query(fingerprint.Hash(), threshold, func(id, distance int) {
+			if e := entries[id]; !grouped[e.file] {
+				consider(e.file, similarMatch{distance: distance, match: e.match})
+			}
+		})
+		if options.Crops {
+			for _, hash := range fingerprint.Crops {
+				index.Query(hash, threshold, func(id, distance int) {
+					if e := entries[id]; !grouped[e.file] && len(e.match) == 0 {
+						consider(e.file, similarMatch{distance: distance, match: "crop"})
+					}
+				})
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		members := make([]int, 0, len(matches))
+		for file := range matches {
+			members = append(members, file)
+		}
+		sort.Ints(members)
+
+		list := Doubles{anchor}
+		for _, file := range members {
+			grouped[file] = true
+			list = append(list, files[file])
+			i.images[files[file]].Transform = matches[file].match
+		}
+		doubles[list.Key()] = list
+		num += len(list)
+	}
+
+	for k, v := range i.hashes {
+		var rest Doubles
+		for _, filename := range v {
+			if _, ok := i.phashes[filename]; !ok && !i.isGroupedSeparately(filename) {
+				rest = append(rest, filename)
+			}
+		}
+		if len(rest) > 1 {
+			doubles[k] = rest
+			num += len(rest)
+		}
+	}
+
+	return num, doubles
+}
+
+const (
+	videoMatchRatio = 0.8
+	minVideoVotes   = 2
+)
+
+type videoFrame struct {
+	file  int
+	frame int
+}
+
+func (i *ImageCollection) FindVideos(threshold int) (int, map[string]Doubles) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	files := make([]string, 0, len(i.videos))
+	for filename, frames := range i.videos {
+		if len(frames) > 0 {
+			files = append(files, filename)
+		}
+	}
+	sort.Strings(files)
+
+	index := phash.NewIndex()
+	var entries []videoFrame
+	for k, filename := range files {
+		for f, hash := range i.videos[filename] {
+			if hash.Uniform() {
+				continue
+			}
+			index.Add(hash, len(entries))
+			entries = append(entries, videoFrame{file: k, frame: f})
+		}
+	}
+
+	num := 0
+	doubles := make(map[string]Doubles)
+	grouped := make([]bool, len(files))
+
+	for k, anchor := range files {
+		if grouped[k] {
+			continue
+		}
+		grouped[k] = true
+
+		frames := i.videos[anchor]
+		votes := make(map[videoFrame]int)
+		for f, hash := range frames {
+			if hash.Uniform() {
+				continue
+			}
+			index.Query(hash, threshold, func(id, distance int) {
+				if e := entries[id]; !grouped[e.file] {
+					votes[videoFrame{file: e.file, frame: e.frame - f}]++
+				}
+			})
+		}
+
+		best := make(map[int]int)
+		for offset, count := range votes {
+			if count > best[offset.file] {
+				best[offset.file] = count
+			}
+		}
+
+		var members []int
+		for file, count := range best {
+			shortest := len(frames)
+			if other := len(i.videos[files[file]]); other < shortest {
+				shortest = other
+			}
+			if count >= minVideoVotes && float64(count) >= videoMatchRatio*float64(shortest) {
+				members = append(members, file)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		sort.Ints(members)
+
+		list := Doubles{anchor}
+		for _, file := range members {
+			grouped[file] = true
+			list = append(list, files[file])
+			if len(i.videos[files[file]]) != len(frames) {
+				i.images[files[file]].Transform = "trimmed"
+			}
+		}
+		doubles[list.Key()] = list
+		num += len(list)
+	}
+
+	return num, doubles
+}
+
+const trackDurationTolerance = 1.0
+
+func (i *ImageCollection) trackDuration(filename string) float64 {
+	if image, ok := i.images[filename]; ok && image.Metadata != nil {
+		return image.Metadata.Duration
+	}
+	return 0
+}
+
+func (i *ImageCollection) FindTracks(threshold int) (int, map[string]Doubles) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	files := make([]string, 0, len(i.prints))
+	for filename := range i.prints {
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+
+	index := phash.NewIndex()
+	for k, filename := range files {
+		index.Add(i.prints[filename], k)
+	}
+
+	num := 0
+	doubles := make(map[string]Doubles)
+	grouped := make(map[string]bool)
+
+	for _, anchor := range files {
+		if grouped[anchor] {
+			continue
+		}
+		grouped[anchor] = true
+
+		var members []int
+		duration := i.trackDuration(anchor)
+		index.Query(i.prints[anchor], threshold, func(id, distance int) {
+			if !grouped[files[id]] && math.Abs(i.trackDuration(files[id])-duration) <= trackDurationTolerance {
+				members = append(members, id)
+			}
+		})
+		if len(members) == 0 {
+			continue
+		}
+		sort.Ints(members)
+
+		list := Doubles{anchor}
+		for _, file := range members {
+			grouped[files[file]] = true
+			list = append(list, files[file])
+		}
+		doubles[list.Key()] = list
+		num += len(list)
+	}
+
+	byHash := make(map[string]Doubles)
+	for filename, hash := range i.tracks {
+		if !grouped[filename] {
+			byHash[hash] = append(byHash[hash], filename)
+		}
+	}
+	for _, list := range byHash {
+		if len(list) > 1 {
+			sort.Strings(list)
+			doubles[list.Key()] = list
+			num += len(list)
+		}
+	}
+
+	return num, doubles
+}
+
 func NewImageCollection() *ImageCollection {
 	return &ImageCollection{
-		hashes: make(map[string][]string),
+		images:   make(map[string]*Image),
+		restored: make(map[string]bool),
+		hashes:   make(map[string][]string),
+		phashes:  make(map[string]*phash.Fingerprint),
+		videos:   make(map[string][]phash.Hash),
+		tracks:   make(map[string]string),
+		prints:   make(map[string]phash.Hash),
+		others:   make(map[string]OtherFile),
 	}
 }
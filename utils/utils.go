@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"doubles/logger"
 	. "doubles/types"
 	"flag"
 	"fmt"
+	"net"
 	"strings"
 )
 
@@ -16,17 +18,73 @@ func InArray(search string, array []string) bool {
 	return false
 }
 
+// IsLoopback reports whether host names the local machine, so it can not be
+// reached from or redirected to another one.
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type settings map[string]string
+
+func (s settings) String() string {
+	return ""
+}
+
+func (s settings) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return fmt.Errorf("Expected key=value, got %q", value)
+	}
+	s[parts[0]] = parts[1]
+	return nil
+}
+
 func GetCliOptions() (*Options, error) {
-	options := &Options{}
+	options := &Options{Settings: make(map[string]string)}
 
 	flag.StringVar(&options.Directory, "dir", "", "Path to directory")
 	flag.BoolVar(&options.Delete, "delete", false, "Delete doubles")
 	flag.BoolVar(&options.Dump, "dump", false, "Save dump to file")
+	flag.StringVar(&options.Keep, "keep", KeepFirst, "Which file to keep in each group: first, metadata, largest")
+	flag.BoolVar(&options.Similar, "similar", false, "Find visually similar images using perceptual hashes")
+	flag.IntVar(&options.Threshold, "threshold", 10, "Maximum perceptual hash distance for similar images")
+	flag.BoolVar(&options.Transforms, "transforms", false, "Match rotated and mirrored copies in similar mode")
+	flag.BoolVar(&options.Crops, "crops", false, "Match scaled-down and lightly cropped copies in similar mode")
+	flag.StringVar(&options.Frames, "frames", FramesFirst, "How to compare animated GIF and PNG images in similar mode: first, all")
+	flag.BoolVar(&options.Video, "video", false, "Scan videos and group re-encoded or trimmed copies")
+	flag.BoolVar(&options.Audio, "audio", false, "Scan music files and group tracks that differ only by tags or bitrate")
+	flag.IntVar(&options.TrackThreshold, "track-threshold", 6, "Maximum loudness envelope distance for re-encoded tracks")
+	flag.BoolVar(&options.Dirs, "dirs", false, "Report directories with identical or contained contents, hashing every file in them")
+	flag.BoolVar(&options.Heatmap, "heatmap", false, "Report how many files of each directory have copies elsewhere and where")
+	flag.BoolVar(&options.Archives, "archives", false, "Look for doubles inside zip and tar archives")
+	flag.BoolVar(&options.ArchiveKeeps, "archive-keeps", false, "Delete every loose copy when an archive holds a byte for byte identical one")
+	flag.StringVar(&options.Format, "format", FormatJSON, "Report format for dump and output: json, jsonl, csv, html")
+	flag.StringVar(&options.Output, "output", "", "Write report to file, - for stdout")
+	flag.StringVar(&options.Stream, "stream", "", "Stream scan events as JSON lines to file, - for stdout")
+	flag.StringVar(&options.Selection, "selection", "", "Apply the keep/delete choices of a selection exported from the HTML report")
+	flag.StringVar(&options.Apply, "apply", "", "Apply keep/delete actions from an edited JSON report")
+	flag.BoolVar(&options.Incremental, "incremental", false, "Reuse hashes from the previous run's database and report what changed since then")
+	flag.BoolVar(&options.Resume, "resume", false, "Continue an interrupted run from its checkpoint, skipping files that were already hashed")
+	flag.BoolVar(&options.Watch, "watch", false, "Keep running and report new files that duplicate existing ones")
+	flag.StringVar(&options.Events, "events", EventsLog, "How to report doubles in watch mode: log, json, webhook")
+	flag.StringVar(&options.Webhook, "webhook", "", "Local URL to post watch events to in webhook mode")
+	flag.BoolVar(&options.Serve, "serve", false, "Serve a REST API for starting scans and fetching results")
+	flag.StringVar(&options.Listen, "listen", "127.0.0.1:8080", "Address to listen on in serve mode")
+	flag.BoolVar(&options.AllowRemote, "allow-remote", false, "Answer API requests from other hosts in serve mode, read-only since only local clients get the token")
+	flag.BoolVar(&options.Quiet, "quiet", false, "Only log warnings and errors")
+	flag.BoolVar(&options.Verbose, "verbose", false, "Also log debug messages")
+	flag.StringVar(&options.LogFormat, "log-format", logger.FormatText, "Log format: text, json")
+	flag.StringVar(&options.Config, "config", "", "Path to a JSON or XML config file overriding the user and project config")
+	flag.Var(settings(options.Settings), "set", "Override a config value, e.g. -set dump_file=out.json (repeatable)")
 	skip := flag.String("skip", "", "Comma separated list of subdirectories to skip")
 	flag.Parse()
 	options.Skip = strings.Split(*skip, ",")
 
-	if len(options.Directory) < 1 {
+	if len(options.Directory) < 1 && len(options.Selection) < 1 && len(options.Apply) < 1 && !options.Serve {
 		fmt.Print("Enter path to directory: ")
 		if _, err := fmt.Scan(&options.Directory); err != nil {
 			return nil, err
@@ -0,0 +1,221 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+	syscall.IN_CREATE | syscall.IN_DELETE
+
+type Watcher struct {
+	Events  chan Event
+	Errors  chan error
+	fd      int
+	epoll   int
+	wake    [2]int
+	mux     sync.Mutex
+	paths   map[int]string
+	once    sync.Once
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (w *Watcher) Add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.paths[wd] = dir
+	return nil
+}
+
+// Close wakes the reader through the pipe, since closing the inotify fd does
+// not interrupt a read that is already blocked on it.
+func (w *Watcher) Close() error {
+	w.once.Do(func() {
+		close(w.done)
+		syscall.Write(w.wake[1], []byte{0})
+	})
+	<-w.stopped
+	return nil
+}
+
+func (w *Watcher) release() {
+	for _, fd := range []int{w.fd, w.epoll, w.wake[0], w.wake[1]} {
+		syscall.Close(fd)
+	}
+}
+
+func (w *Watcher) send(event Event) bool {
+	select {
+	case w.Events <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *Watcher) wait() error {
+	events := make([]syscall.EpollEvent, 2)
+	for {
+		n, err := syscall.EpollWait(w.epoll, events, -1)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return os.NewSyscallError("epoll_wait", err)
+		}
+		for _, event := range events[:n] {
+			if int(event.Fd) == w.wake[0] {
+				return errClosed
+			}
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+}
+
+func (w *Watcher) path(wd int, name string, ignored bool) (string, bool) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	dir, ok := w.paths[wd]
+	if ignored {
+		delete(w.paths, wd)
+	}
+	return filepath.Join(dir, name), ok
+}
+
+// forget drops the watches of a directory that left the tree, since the kernel
+// keeps reporting its events under the old path otherwise.
+func (w *Watcher) forget(dir string) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for wd, path := range w.paths {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.paths, wd)
+		}
+	}
+}
+
+func (w *Watcher) read() {
+	defer close(w.stopped)
+	defer w.release()
+	defer close(w.Events)
+	defer close(w.Errors)
+
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if err := w.wait(); err != nil {
+			if err != errClosed {
+				w.Errors <- err
+			}
+			return
+		}
+		n, err := syscall.Read(w.fd, buffer)
+		if err == syscall.EINTR || err == syscall.EAGAIN {
+			continue
+		}
+		if err != nil || n <= 0 {
+			if err != nil {
+				w.Errors <- os.NewSyscallError("read", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			end := start + int(raw.Len)
+			offset = end
+			if end > n {
+				break
+			}
+
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				if !w.send(Event{Op: Overflow}) {
+					return
+				}
+				continue
+			}
+
+			name := string(buffer[start:end])
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			filename, ok := w.path(int(raw.Wd), name, raw.Mask&syscall.IN_IGNORED != 0)
+			if !ok || len(name) == 0 {
+				continue
+			}
+
+			sent := true
+			switch {
+			case raw.Mask&syscall.IN_ISDIR != 0:
+				if raw.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					sent = w.send(Event{Path: filename, Op: Directory})
+				} else if raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0 {
+					w.forget(filename)
+					sent = w.send(Event{Path: filename, Op: RemoveDirectory})
+				}
+			case raw.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+				sent = w.send(Event{Path: filename, Op: Write})
+			case raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+				sent = w.send(Event{Path: filename, Op: Remove})
+			}
+			if !sent {
+				return
+			}
+		}
+	}
+}
+
+func New() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &Watcher{
+		Events:  make(chan Event, 64),
+		Errors:  make(chan error, 1),
+		fd:      fd,
+		epoll:   -1,
+		wake:    [2]int{-1, -1},
+		paths:   make(map[int]string),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := w.setup(); err != nil {
+		w.release()
+		return nil, err
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *Watcher) setup() error {
+	var err error
+	if w.epoll, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC); err != nil {
+		return os.NewSyscallError("epoll_create1", err)
+	}
+	if err := syscall.Pipe2(w.wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		return os.NewSyscallError("pipe2", err)
+	}
+	for _, fd := range []int{w.fd, w.wake[0]} {
+		event := &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+		if err := syscall.EpollCtl(w.epoll, syscall.EPOLL_CTL_ADD, fd, event); err != nil {
+			return os.NewSyscallError("epoll_ctl", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package watch
+
+import "errors"
+
+var (
+	errUnsupported = errors.New("Watching directories is not supported on this platform")
+	errClosed      = errors.New("Watcher closed")
+)
+
+type Op int
+
+const (
+	Write Op = iota
+	Remove
+	Directory
+	RemoveDirectory
+	Overflow
+)
+
+type Event struct {
+	Path string
+	Op   Op
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+}
+
+func (w *Watcher) Add(dir string) error {
+	return errUnsupported
+}
+
+func (w *Watcher) Close() error {
+	return nil
+}
+
+func New() (*Watcher, error) {
+	return nil, errUnsupported
+}